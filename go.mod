@@ -1,7 +1,11 @@
-module main.go
+module github.com/Striker2k18/go-oVirt-vm
 
-go 1.20
+go 1.21
 
-require github.com/ovirt/go-ovirt v4.3.4+incompatible
+require (
+	github.com/ovirt/go-ovirt v4.3.4+incompatible
+	golang.org/x/time v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require github.com/stretchr/testify v1.8.4 // indirect
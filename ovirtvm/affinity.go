@@ -0,0 +1,69 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"sync"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// affinityMu serializes affinity group creation so concurrent VMs asking for
+// the same new group don't race to create it twice.
+var affinityMu sync.Mutex
+
+// ensureAffinityGroup returns the ID of the named affinity group in the
+// cluster, creating it with the given policy if it doesn't exist yet.
+// Existing groups keep whatever policy they already have.
+func ensureAffinityGroup(groupsService *ovirtsdk4.AffinityGroupsService, name string, positive, enforcing bool) (string, error) {
+	affinityMu.Lock()
+	defer affinityMu.Unlock()
+
+	resp, err := groupsService.List().Send()
+	if err != nil {
+		return "", fmt.Errorf("failed to list affinity groups: %w", err)
+	}
+	if groups, ok := resp.Groups(); ok {
+		for _, group := range groups.Slice() {
+			if groupName, _ := group.Name(); groupName == name {
+				id, _ := group.Id()
+				return id, nil
+			}
+		}
+	}
+
+	group, err := ovirtsdk4.NewAffinityGroupBuilder().
+		Name(name).
+		Positive(positive).
+		Enforcing(enforcing).
+		Build()
+	if err != nil {
+		return "", fmt.Errorf("failed to build affinity group %s: %w", name, err)
+	}
+	addResp, err := groupsService.Add().Group(group).Send()
+	if err != nil {
+		return "", fmt.Errorf("failed to create affinity group %s: %w", name, err)
+	}
+	created, ok := addResp.Group()
+	if !ok {
+		return "", fmt.Errorf("failed to create affinity group %s: engine returned no group", name)
+	}
+	id, _ := created.Id()
+	return id, nil
+}
+
+// addToAffinityGroup adds the VM to the named affinity group of the cluster.
+func addToAffinityGroup(conn *ovirtsdk4.Connection, clusterID, vmID, name string, positive, enforcing bool) error {
+	groupsService := conn.SystemService().ClustersService().ClusterService(clusterID).AffinityGroupsService()
+	groupID, err := ensureAffinityGroup(groupsService, name, positive, enforcing)
+	if err != nil {
+		return err
+	}
+	vm, err := ovirtsdk4.NewVmBuilder().Id(vmID).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build VM reference: %w", err)
+	}
+	if _, err := groupsService.GroupService(groupID).VmsService().Add().Vm(vm).Send(); err != nil {
+		return fmt.Errorf("failed to add VM to affinity group %s: %w", name, err)
+	}
+	return nil
+}
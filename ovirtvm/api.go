@@ -0,0 +1,92 @@
+package ovirtvm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// Defaults used by ProvisionVM, matching the command-line defaults.
+const (
+	DefaultCreateTimeout  = 10 * time.Minute
+	DefaultStartTimeout   = 5 * time.Minute
+	DefaultGuestIPTimeout = 5 * time.Minute
+	DefaultMaxRetries     = 3
+)
+
+// newConnection connects to the engine described by cfg with the given
+// password and per-request timeout.
+func newConnection(cfg Config, password string, timeout time.Duration) (*ovirtsdk4.Connection, error) {
+	return ovirtsdk4.NewConnectionBuilder().
+		URL(cfg.URL).
+		Username(cfg.Username).
+		Password(password).
+		Insecure(cfg.Insecure).
+		CAFile(cfg.CAFile).
+		Timeout(timeout).
+		Build()
+}
+
+// Connect opens a connection to the engine using the URL, credentials and
+// certificate settings of cfg. The password is resolved the way the tool
+// does: Password, then PasswordFile, then $OVIRT_PASSWORD. timeout bounds
+// each API request; 0 waits forever. The caller closes the connection.
+func Connect(cfg Config, timeout time.Duration) (*ovirtsdk4.Connection, error) {
+	password, err := resolvePassword(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newConnection(cfg, password, timeout)
+}
+
+// ParseCSV reads VM definitions in the tool's CSV format from r. With header
+// set the first record names the columns; otherwise they are positional.
+// All invalid records are reported together in the returned error.
+func ParseCSV(r io.Reader, header bool) ([]VMParams, error) {
+	return readCSV(r, header, false)
+}
+
+// ProvisionVM creates the VM described by params and, if its Start column
+// asks for it, starts it, taking the same steps as one row of a tool run.
+// params normally come from ParseCSV; storage domain and network defaults
+// are not applied. It returns the new VM's ID, which is also set when the
+// VM was created but a later step such as starting it failed. Non-fatal
+// problems are logged through the default slog logger.
+func ProvisionVM(ctx context.Context, conn *ovirtsdk4.Connection, params VMParams) (string, error) {
+	if problems := validateVMParams(params); len(problems) > 0 {
+		return "", fmt.Errorf("invalid VM %s: %s", params.Name, strings.Join(problems, "; "))
+	}
+	opts := createOptions{
+		CreateTimeout:  DefaultCreateTimeout,
+		StartTimeout:   DefaultStartTimeout,
+		GuestIPTimeout: DefaultGuestIPTimeout,
+		MaxRetries:     DefaultMaxRetries,
+	}
+	errs := &errorLog{}
+	result := createVM(ctx, params, conn, opts, errs)
+
+	var failure error
+	for _, err := range errs.all() {
+		var rowErr *rowError
+		if errors.As(err, &rowErr) && rowErr.warning {
+			logRowError(err)
+			continue
+		}
+		if failure == nil {
+			failure = err
+		}
+	}
+	switch {
+	case failure != nil:
+	case result.Status == statusCancelled:
+		failure = ctx.Err()
+	case result.Status == statusSkipped:
+		failure = fmt.Errorf("VM %s already exists", params.Name)
+	}
+	return result.ID, failure
+}
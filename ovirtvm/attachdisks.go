@@ -0,0 +1,124 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// attachedDisk is an existing disk listed in the AttachDisks column.
+type attachedDisk struct {
+	ID        string
+	Interface ovirtsdk4.DiskInterface
+	ReadOnly  bool
+	Shared    bool // The disk is meant to be attached to other VMs as well
+}
+
+// parseAttachDisks parses an AttachDisks column value of the form
+// "id[:interface[:flag...]];..." such as "6f1c...:virtio_scsi:shared:ro".
+// The flags are ro, which attaches the disk read-only, and shared, which
+// requires the disk to be shareable. Entries without an interface use
+// defaultInterface.
+func parseAttachDisks(value string, defaultInterface ovirtsdk4.DiskInterface) ([]attachedDisk, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var disks []attachedDisk
+	seen := make(map[string]bool)
+	for i, entry := range strings.Split(value, ";") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		disk := attachedDisk{ID: parts[0], Interface: defaultInterface}
+		if disk.ID == "" {
+			return nil, fmt.Errorf("attached disk %d: expected id[:interface[:flag...]], got %q", i+1, entry)
+		}
+		if seen[disk.ID] {
+			return nil, fmt.Errorf("disk %s is attached more than once", disk.ID)
+		}
+		seen[disk.ID] = true
+		if len(parts) > 1 && parts[1] != "" {
+			var err error
+			disk.Interface, err = parseDiskInterface(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("attached disk %d: %w", i+1, err)
+			}
+		}
+		for _, flag := range parts[min(len(parts), 2):] {
+			switch strings.ToLower(flag) {
+			case "ro":
+				disk.ReadOnly = true
+			case "shared":
+				disk.Shared = true
+			default:
+				return nil, fmt.Errorf("attached disk %d: unknown flag %q (valid: ro, shared)", i+1, flag)
+			}
+		}
+		disks = append(disks, disk)
+	}
+	return disks, nil
+}
+
+// checkSharedDisks reports existing disks attached by more than one record
+// without the shared flag. Only a shareable disk can be attached to several
+// VMs, and the flag makes the intent explicit on every row.
+func checkSharedDisks(vms []VMParams) []error {
+	var invalid []error
+	firstLines := make(map[string]int)
+	shared := make(map[string]bool)
+	for _, vm := range vms {
+		for _, disk := range vm.AttachDisks {
+			first, ok := firstLines[disk.ID]
+			if !ok {
+				firstLines[disk.ID] = vm.line
+				shared[disk.ID] = disk.Shared
+				continue
+			}
+			if !disk.Shared || !shared[disk.ID] {
+				invalid = append(invalid, fmt.Errorf("invalid record at line %d: disk %s is also attached at line %d; mark it shared on both", vm.line, disk.ID, first))
+			}
+		}
+	}
+	return invalid
+}
+
+// findAttachableDisk looks up an existing disk by ID and checks that it can
+// be attached: it must not be locked or illegal, and it must be shareable if
+// shared is set. The engine itself refuses to attach a disk that is not
+// shareable to a second VM.
+func findAttachableDisk(conn *ovirtsdk4.Connection, id string, shared bool) (*ovirtsdk4.Disk, error) {
+	resp, err := conn.SystemService().DisksService().DiskService(id).Get().Send()
+	if err != nil {
+		return nil, fmt.Errorf("disk %s not found: %w", id, err)
+	}
+	disk, ok := resp.Disk()
+	if !ok {
+		return nil, fmt.Errorf("disk %s not found", id)
+	}
+	name, _ := disk.Alias()
+	if status, _ := disk.Status(); status == ovirtsdk4.DISKSTATUS_LOCKED || status == ovirtsdk4.DISKSTATUS_ILLEGAL {
+		return nil, fmt.Errorf("disk %s (%s) is %s", id, name, status)
+	}
+	if shareable, _ := disk.Shareable(); shared && !shareable {
+		return nil, fmt.Errorf("disk %s (%s) is marked shared but is not shareable", id, name)
+	}
+	return disk, nil
+}
+
+// attachExistingDisk attaches an existing disk to the VM, never as its boot disk.
+func attachExistingDisk(vmService *ovirtsdk4.VmService, disk attachedDisk) error {
+	attachment, err := ovirtsdk4.NewDiskAttachmentBuilder().
+		DiskBuilder(ovirtsdk4.NewDiskBuilder().Id(disk.ID)).
+		Interface(disk.Interface).
+		ReadOnly(disk.ReadOnly).
+		Active(true).
+		Bootable(false).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build attachment: %w", err)
+	}
+	if _, err := vmService.DiskAttachmentsService().Add().Attachment(attachment).Send(); err != nil {
+		return fmt.Errorf("failed to attach disk: %w", err)
+	}
+	return nil
+}
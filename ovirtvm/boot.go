@@ -0,0 +1,76 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// bootDevices lists the boot devices accepted in the BootOrder column.
+var bootDevices = []ovirtsdk4.BootDevice{
+	ovirtsdk4.BOOTDEVICE_CDROM,
+	ovirtsdk4.BOOTDEVICE_HD,
+	ovirtsdk4.BOOTDEVICE_NETWORK,
+}
+
+// parseBootOrder parses a semicolon-separated list of boot devices such as
+// "cdrom;hd;network". Commas are accepted as separators too, since the
+// column took them before it followed the other list columns. An empty
+// value keeps the template's boot order.
+func parseBootOrder(value string) ([]ovirtsdk4.BootDevice, error) {
+	if value == "" {
+		return nil, nil
+	}
+	valid := make([]string, 0, len(bootDevices))
+	for _, device := range bootDevices {
+		valid = append(valid, string(device))
+	}
+
+	var order []ovirtsdk4.BootDevice
+	seen := make(map[ovirtsdk4.BootDevice]bool)
+	for _, name := range splitList(strings.ReplaceAll(value, ",", ";")) {
+		var device ovirtsdk4.BootDevice
+		for _, candidate := range bootDevices {
+			if strings.EqualFold(name, string(candidate)) {
+				device = candidate
+			}
+		}
+		if device == "" {
+			return nil, fmt.Errorf("unknown boot device %q (valid: %s)", name, strings.Join(valid, ", "))
+		}
+		if seen[device] {
+			return nil, fmt.Errorf("boot device %s is listed more than once", device)
+		}
+		seen[device] = true
+		order = append(order, device)
+	}
+	return order, nil
+}
+
+// newOsBuilder builds the VM's operating system settings: the OsType column
+// and the boot order. Without a BootOrder column, VMs with an ISO boot from
+// it and Blank VMs boot from the network or CD to install an OS; others keep
+// the template's boot order. It returns nil when there is nothing to set.
+func newOsBuilder(vmParams VMParams, hasISO, blank bool) *ovirtsdk4.OperatingSystemBuilder {
+	var bootOrder []ovirtsdk4.BootDevice
+	switch {
+	case len(vmParams.BootOrder) > 0:
+		bootOrder = vmParams.BootOrder
+	case hasISO:
+		bootOrder = []ovirtsdk4.BootDevice{ovirtsdk4.BOOTDEVICE_CDROM, ovirtsdk4.BOOTDEVICE_HD}
+	case blank:
+		bootOrder = []ovirtsdk4.BootDevice{ovirtsdk4.BOOTDEVICE_NETWORK, ovirtsdk4.BOOTDEVICE_CDROM, ovirtsdk4.BOOTDEVICE_HD}
+	}
+	if len(bootOrder) == 0 && vmParams.OSType == "" {
+		return nil
+	}
+	osBuilder := ovirtsdk4.NewOperatingSystemBuilder()
+	if vmParams.OSType != "" {
+		osBuilder.Type(vmParams.OSType)
+	}
+	if len(bootOrder) > 0 {
+		osBuilder.BootBuilder(ovirtsdk4.NewBootBuilder().Devices(bootOrder))
+	}
+	return osBuilder
+}
@@ -0,0 +1,43 @@
+package ovirtvm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// TestParseBootOrder checks that boot devices split on semicolons like the
+// other list columns, with commas still accepted.
+func TestParseBootOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []ovirtsdk4.BootDevice
+		wantErr string
+	}{
+		{name: "empty", value: ""},
+		{name: "semicolons", value: "cdrom;hd; network", want: []ovirtsdk4.BootDevice{ovirtsdk4.BOOTDEVICE_CDROM, ovirtsdk4.BOOTDEVICE_HD, ovirtsdk4.BOOTDEVICE_NETWORK}},
+		{name: "commas", value: "network,HD", want: []ovirtsdk4.BootDevice{ovirtsdk4.BOOTDEVICE_NETWORK, ovirtsdk4.BOOTDEVICE_HD}},
+		{name: "unknown device", value: "hd;usb", wantErr: `unknown boot device "usb"`},
+		{name: "duplicate device", value: "hd;cdrom,hd", wantErr: "boot device hd is listed more than once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBootOrder(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseBootOrder(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBootOrder(%q): %v", tt.value, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBootOrder(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package ovirtvm
+
+import (
+	"sync"
+	"sync/atomic"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// cached memoizes lookups by name. Concurrent callers asking for the same
+// name share a single engine call; failed lookups are not kept, so a
+// transient error is retried by the next caller.
+type cached[T any] struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry[T]
+
+	lookups atomic.Int64 // Calls that reached the engine
+	hits    atomic.Int64 // Calls answered from the cache
+}
+
+type cacheEntry[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+func (c *cached[T]) get(name string, lookup func() (T, error)) (T, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[name]; ok {
+		c.mu.Unlock()
+		c.hits.Add(1)
+		<-entry.done
+		return entry.value, entry.err
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*cacheEntry[T])
+	}
+	entry := &cacheEntry[T]{done: make(chan struct{})}
+	c.entries[name] = entry
+	c.mu.Unlock()
+
+	c.lookups.Add(1)
+	entry.value, entry.err = lookup()
+	if entry.err != nil {
+		c.mu.Lock()
+		delete(c.entries, name)
+		c.mu.Unlock()
+	}
+	close(entry.done)
+	return entry.value, entry.err
+}
+
+// lookupCache shares template, cluster, storage domain and instance type
+// lookups across workers so a batch where many rows use the same names asks
+// the engine once per name. A nil *lookupCache looks everything up directly.
+type lookupCache struct {
+	templates        cached[*ovirtsdk4.Template]
+	templateSearches cached[*ovirtsdk4.Template]
+	clusters         cached[*ovirtsdk4.Cluster]
+	storageDomains   cached[*ovirtsdk4.StorageDomain]
+	instanceTypes    cached[*ovirtsdk4.InstanceType]
+}
+
+func (c *lookupCache) template(conn *ovirtsdk4.Connection, name string) (*ovirtsdk4.Template, error) {
+	if c == nil {
+		return findTemplate(conn, name)
+	}
+	return c.templates.get(name, func() (*ovirtsdk4.Template, error) { return findTemplate(conn, name) })
+}
+
+// templateSearch is cached per expression, so every row using one search
+// gets the same template even if a newer one appears during the run.
+func (c *lookupCache) templateSearch(conn *ovirtsdk4.Connection, search string) (*ovirtsdk4.Template, error) {
+	if c == nil {
+		return searchTemplate(conn, search)
+	}
+	return c.templateSearches.get(search, func() (*ovirtsdk4.Template, error) { return searchTemplate(conn, search) })
+}
+
+func (c *lookupCache) cluster(conn *ovirtsdk4.Connection, name, dataCenter string) (*ovirtsdk4.Cluster, error) {
+	if c == nil {
+		return findCluster(conn, name, dataCenter)
+	}
+	return c.clusters.get(clusterKey(name, dataCenter), func() (*ovirtsdk4.Cluster, error) { return findCluster(conn, name, dataCenter) })
+}
+
+func (c *lookupCache) storageDomain(conn *ovirtsdk4.Connection, name string) (*ovirtsdk4.StorageDomain, error) {
+	if c == nil {
+		return findStorageDomain(conn, name)
+	}
+	return c.storageDomains.get(name, func() (*ovirtsdk4.StorageDomain, error) { return findStorageDomain(conn, name) })
+}
+
+func (c *lookupCache) instanceType(conn *ovirtsdk4.Connection, name string) (*ovirtsdk4.InstanceType, error) {
+	if c == nil {
+		return findInstanceType(conn, name)
+	}
+	return c.instanceTypes.get(name, func() (*ovirtsdk4.InstanceType, error) { return findInstanceType(conn, name) })
+}
+
+// stats returns how many lookups reached the engine and how many were
+// answered from the cache.
+func (c *lookupCache) stats() (lookups, hits int64) {
+	lookups = c.templates.lookups.Load() + c.templateSearches.lookups.Load() + c.clusters.lookups.Load() + c.storageDomains.lookups.Load() + c.instanceTypes.lookups.Load()
+	hits = c.templates.hits.Load() + c.templateSearches.hits.Load() + c.clusters.hits.Load() + c.storageDomains.hits.Load() + c.instanceTypes.hits.Load()
+	return lookups, hits
+}
@@ -0,0 +1,110 @@
+package ovirtvm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCachedSharesConcurrentLookups has 100 concurrent rows ask for 3
+// template names and checks that the engine is asked once per name.
+func TestCachedSharesConcurrentLookups(t *testing.T) {
+	const rows = 100
+	names := []string{"rhel9", "ubuntu22", "win2022"}
+	var c cached[string]
+	var calls atomic.Int64
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < rows; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			<-start
+			got, err := c.get(name, func() (string, error) {
+				calls.Add(1)
+				// Slow enough that other rows arrive while the lookup is in flight
+				time.Sleep(10 * time.Millisecond)
+				return "id-" + name, nil
+			})
+			if err != nil || got != "id-"+name {
+				t.Errorf("get(%s) = %q, %v; want %q", name, got, err, "id-"+name)
+			}
+		}(names[i%len(names)])
+	}
+	close(start)
+	wg.Wait()
+
+	if n := calls.Load(); n != int64(len(names)) {
+		t.Errorf("lookup ran %d times, want %d", n, len(names))
+	}
+	if n := c.lookups.Load(); n != int64(len(names)) {
+		t.Errorf("lookups = %d, want %d", n, len(names))
+	}
+	if n := c.hits.Load(); n != rows-int64(len(names)) {
+		t.Errorf("hits = %d, want %d", n, rows-len(names))
+	}
+}
+
+// TestCachedRetriesFailedLookups checks that a failed lookup is not kept.
+func TestCachedRetriesFailedLookups(t *testing.T) {
+	var c cached[string]
+	attempt := 0
+	lookup := func() (string, error) {
+		attempt++
+		if attempt == 1 {
+			return "", errors.New("engine unavailable")
+		}
+		return fmt.Sprintf("id-%d", attempt), nil
+	}
+
+	if _, err := c.get("rhel9", lookup); err == nil {
+		t.Fatal("first get succeeded, want the lookup's error")
+	}
+	got, err := c.get("rhel9", lookup)
+	if err != nil || got != "id-2" {
+		t.Fatalf("second get = %q, %v; want id-2", got, err)
+	}
+	got, err = c.get("rhel9", lookup)
+	if err != nil || got != "id-2" || attempt != 2 {
+		t.Fatalf("third get = %q, %v after %d lookups; want the cached id-2 after 2", got, err, attempt)
+	}
+}
+
+// BenchmarkTemplateLookups provisions 100 rows sharing 3 templates and
+// reports how many lookups reach the engine per batch, with and without
+// the cache. The lookup stands in for an engine call of about a millisecond.
+func BenchmarkTemplateLookups(b *testing.B) {
+	const rows = 100
+	names := []string{"rhel9", "ubuntu22", "win2022"}
+	for _, useCache := range []bool{false, true} {
+		b.Run(fmt.Sprintf("cache=%t", useCache), func(b *testing.B) {
+			var calls atomic.Int64
+			lookup := func() (string, error) {
+				calls.Add(1)
+				time.Sleep(time.Millisecond)
+				return "id", nil
+			}
+			for n := 0; n < b.N; n++ {
+				var c cached[string]
+				var wg sync.WaitGroup
+				for i := 0; i < rows; i++ {
+					wg.Add(1)
+					go func(name string) {
+						defer wg.Done()
+						if useCache {
+							c.get(name, lookup)
+						} else {
+							lookup()
+						}
+					}(names[i%len(names)])
+				}
+				wg.Wait()
+			}
+			b.ReportMetric(float64(calls.Load())/float64(b.N), "lookups/batch")
+		})
+	}
+}
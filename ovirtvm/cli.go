@@ -0,0 +1,478 @@
+package ovirtvm
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// errStoppedOnError is the cause of a run cancelled by --stop-on-error.
+var errStoppedOnError = errors.New("a VM failed")
+
+// Main runs the command-line tool: it parses the flags, then creates,
+// deletes or lists VMs as they ask, and exits non-zero if anything failed.
+func Main() {
+	var cfg Config
+	flag.StringVar(&cfg.CSVFile, "csv", "vm_params.csv", "File containing VM parameters, in the format given by --format")
+	flag.StringVar(&cfg.Format, "format", "csv", "Format of the --csv file: csv, yaml or json")
+	flag.StringVar(&cfg.URL, "url", "https://your.ovirt.engine/ovirt-engine/api", "oVirt engine URL")
+	flag.StringVar(&cfg.Username, "username", "your-username", "oVirt username")
+	flag.StringVar(&cfg.Password, "password", "", "oVirt password (prefer --password-file or OVIRT_PASSWORD)")
+	flag.StringVar(&cfg.PasswordFile, "password-file", "", "File whose first line is the oVirt password")
+	flag.BoolVar(&cfg.Insecure, "insecure", false, "Skip SSL certificate verification")
+	flag.StringVar(&cfg.CAFile, "ca-file", "", "PEM bundle of CA certificates used to verify the engine")
+	flag.IntVar(&cfg.Concurrency, "concurrency", 5, "Number of concurrent VM creations; 1 processes rows strictly in CSV order")
+	flag.BoolVar(&cfg.AdaptiveConcurrency, "adaptive-concurrency", false, "Start at --min-concurrency and adjust up to --concurrency as the engine copes, backing off on failures and slow VMs")
+	flag.IntVar(&cfg.MinConcurrency, "min-concurrency", 1, "Lowest concurrency --adaptive-concurrency backs off to")
+	flag.IntVar(&cfg.Connections, "connections", 1, "Number of engine connections shared round-robin by the workers")
+	flag.StringVar(&cfg.StorageDomain, "storage-domain", "", "Default storage domain for VMs without a StorageDomain column")
+	flag.BoolVar(&cfg.AutoStorage, "auto-storage", false, "Place VMs without a StorageDomain column on the data domain with the most free space")
+	flag.Var(&cfg.StorageDomains, "storage-domains", "Comma-separated storage domains assigned round-robin to VMs without a StorageDomain column")
+	flag.StringVar(&cfg.Network, "network", "", "Default vnic profile for VMs without a Network column")
+	flag.StringVar(&cfg.SSHKeyFile, "ssh-key-file", "", "File of SSH public keys injected into VMs without an SSHKey column")
+	flag.BoolVar(&cfg.Header, "header", false, "Read column names from the first CSV record instead of using fixed positions")
+	flag.BoolVar(&cfg.Start, "start", false, "Start VMs after creation (overridden per row by the Start column)")
+	flag.DurationVar((*time.Duration)(&cfg.CreateTimeout), "create-timeout", DefaultCreateTimeout, "How long to wait for a created VM and its disks to become ready")
+	flag.DurationVar((*time.Duration)(&cfg.APITimeout), "api-timeout", 2*time.Minute, "Timeout for each engine API request; 0 waits forever")
+	flag.DurationVar((*time.Duration)(&cfg.StartTimeout), "start-timeout", DefaultStartTimeout, "How long to wait for a started VM to reach the up state")
+	flag.DurationVar((*time.Duration)(&cfg.GuestIPTimeout), "guest-ip-timeout", DefaultGuestIPTimeout, "How long to wait for a started VM's guest agent to report its IP; 0 skips the check")
+	flag.Float64Var(&cfg.RateLimit, "rate-limit", 0, "Maximum VM create and start calls per second across all workers, e.g. 0.5; 0 for no limit")
+	flag.IntVar(&cfg.MaxRetries, "max-retries", DefaultMaxRetries, "Number of retries for transient engine failures when creating or starting a VM")
+	flag.BoolVar(&cfg.FailFast, "fail-fast", false, "Stop at the first invalid CSV record instead of reporting them all")
+	flag.BoolVar(&cfg.DryRun, "dry-run", false, "Validate the CSV and referenced resources without creating VMs")
+	flag.StringVar(&cfg.SnapshotAfter, "snapshot-after", "", "Take a snapshot with this description of each VM once it is ready, or up when started (overridden per row by the Snapshot column)")
+	flag.BoolVar(&cfg.SealToTemplate, "seal-to-template", false, "Seal each VM into a template once it is provisioned, named by the TemplateName column or after the VM")
+	flag.BoolVar(&cfg.PrintCloudInit, "print-cloud-init", false, "Print each Linux VM's rendered cloud-config to stdout, e.g. with --dry-run")
+	flag.BoolVar(&cfg.StopOnError, "stop-on-error", false, "Stop starting new VMs once any VM fails, for dependency-ordered files; VMs in flight wrap up as on an interrupt")
+	flag.BoolVar(&cfg.Force, "force", false, "Attempt to create VMs even if a VM with the same name already exists or pre-flight validation fails")
+	flag.BoolVar(&cfg.AffinityPositive, "affinity-positive", false, "Create missing affinity groups with positive affinity instead of anti-affinity")
+	flag.BoolVar(&cfg.AffinityEnforcing, "affinity-enforcing", false, "Create missing affinity groups as enforcing")
+	deleteMode := flag.Bool("delete", false, "Stop and remove the VMs listed in the CSV instead of creating them")
+	flag.BoolVar(&cfg.DetachOnly, "detach-only", false, "With --delete, detach and keep the VMs' disks")
+	flag.DurationVar((*time.Duration)(&cfg.Timeout), "timeout", 0, "Give up on the whole run after this long (0 means no limit)")
+	flag.StringVar(&cfg.NameFilter, "name-filter", "", "Only process VMs whose name matches this glob, or regular expression when wrapped in slashes")
+	flag.IntVar(&cfg.Offset, "offset", 0, "Skip this many rows of the input, e.g. to resume a partial run")
+	flag.IntVar(&cfg.Limit, "limit", 0, "Process at most this many rows after --offset; 0 means all")
+	flag.BoolVar(&cfg.NoSummary, "no-summary", false, "Don't print the table of per-VM results to stdout at the end of the run")
+	flag.StringVar(&cfg.ReportFile, "report", "", "Write a JSON report of per-VM results to this file")
+	flag.StringVar(&cfg.OutputCSV, "output-csv", "", "Write the input rows with each VM's ID, status and error to this CSV file")
+	flag.StringVar(&cfg.MetricsFile, "metrics-file", "", "Write Prometheus metrics for the run to this file, e.g. for the node_exporter textfile collector")
+	flag.StringVar(&cfg.LogLevel, "log-level", "info", "Minimum level of log messages: debug, info, warn or error")
+	flag.StringVar(&cfg.LogFormat, "log-format", "text", "Log output format: text or json")
+	listTemplatesFlag := flag.Bool("list-templates", false, "Print the available templates and exit")
+	listClustersFlag := flag.Bool("list-clusters", false, "Print the available clusters and exit")
+	listStorageDomainsFlag := flag.Bool("list-storage-domains", false, "Print the available storage domains and exit")
+	verify := flag.Bool("verify", false, "Check the URL and credentials, print the engine version and user, and exit")
+	flag.StringVar(&cfg.Output, "output", "plain", "Output format for --verify and the --list-* flags: plain or json")
+	configFile := flag.String("config", "", "YAML or JSON file with settings; command-line flags take precedence")
+
+	flag.Parse()
+
+	if *configFile != "" {
+		if err := loadConfig(*configFile, &cfg); err != nil {
+			fatal("Failed to load config", err)
+		}
+		// Parse again so flags given on the command line override the file
+		flag.Parse()
+	}
+
+	if err := setupLogging(cfg.LogLevel, cfg.LogFormat); err != nil {
+		fatal("Failed to set up logging", err)
+	}
+
+	if cfg.Insecure && cfg.CAFile != "" {
+		slog.Warn("Both --insecure and --ca-file are set; certificate verification is skipped", "event", "config_warning")
+	}
+
+	// The SDK's HTTP transport has no proxy hook, so say so rather than fail to connect mysteriously
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		if os.Getenv(name) != "" {
+			slog.Warn("Proxy environment variables are ignored; the engine is contacted directly", "event", "proxy_ignored", "variable", name)
+			break
+		}
+	}
+
+	apiTimeout := time.Duration(cfg.APITimeout)
+	if apiTimeout < 0 {
+		fatal("Invalid --api-timeout", fmt.Errorf("must not be negative, got %s", apiTimeout))
+	}
+
+	// Smoke test for CI: a failed login exits non-zero through fatal
+	if *verify {
+		connect, err := engineConnector(cfg, apiTimeout)
+		if err != nil {
+			fatal("Failed to resolve oVirt password", err)
+		}
+		pool, err := newConnPool(1, connect)
+		if err != nil {
+			fatal("Failed to create connection to the oVirt engine", err)
+		}
+		err = verifyConnection(pool.get(), cfg.Output, os.Stdout)
+		pool.Close()
+		if err != nil {
+			fatal("Failed to verify connection", err)
+		}
+		return
+	}
+
+	// Discovery mode: print what exists on the engine without reading a CSV
+	var kinds []string
+	listers := map[string]lister{
+		"templates":       listTemplates,
+		"clusters":        listClusters,
+		"storage_domains": listStorageDomains,
+	}
+	if *listTemplatesFlag {
+		kinds = append(kinds, "templates")
+	}
+	if *listClustersFlag {
+		kinds = append(kinds, "clusters")
+	}
+	if *listStorageDomainsFlag {
+		kinds = append(kinds, "storage_domains")
+	}
+	if len(kinds) > 0 {
+		connect, err := engineConnector(cfg, apiTimeout)
+		if err != nil {
+			fatal("Failed to resolve oVirt password", err)
+		}
+		pool, err := newConnPool(1, connect)
+		if err != nil {
+			fatal("Failed to create connection to the oVirt engine", err)
+		}
+		err = listResources(pool.get(), kinds, listers, cfg.Output, os.Stdout)
+		pool.Close()
+		if err != nil {
+			fatal("Failed to list resources", err)
+		}
+		return
+	}
+
+	var vms []VMParams
+	var err error
+	switch cfg.Format {
+	case "csv":
+		vms, err = parseCSV(cfg.CSVFile, cfg.Header, cfg.FailFast)
+	case "yaml", "json":
+		vms, err = parseDefinitions(cfg.CSVFile, cfg.FailFast)
+	default:
+		fatal("Invalid --format", fmt.Errorf("unknown format %q: must be csv, yaml or json", cfg.Format))
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		// Log each problem on its own line rather than one long message
+		problems := joined.Unwrap()
+		for _, problem := range problems {
+			slog.Error("Invalid VM record", "event", "invalid_record", "error", problem)
+		}
+		fatal("Failed to parse VM parameters", fmt.Errorf("%d problems found", len(problems)))
+	}
+	if err != nil {
+		fatal("Failed to parse VM parameters", err)
+	}
+
+	var sshKeys []string
+	if cfg.SSHKeyFile != "" {
+		sshKeys, err = readSSHKeys(cfg.SSHKeyFile)
+		if err != nil {
+			fatal("Failed to load SSH keys", err)
+		}
+	}
+
+	for i := range vms {
+		if len(vms[i].SSHKeys) == 0 && !isWindows(vms[i].OSType) {
+			vms[i].SSHKeys = sshKeys
+		}
+		if vms[i].StorageDomain == "" {
+			vms[i].StorageDomain = cfg.StorageDomain
+		}
+		if vms[i].Network == "" {
+			vms[i].Network = cfg.Network
+		}
+	}
+
+	if cfg.NameFilter != "" {
+		match, err := nameMatcher(cfg.NameFilter)
+		if err != nil {
+			fatal("Invalid --name-filter", err)
+		}
+		total := len(vms)
+		var matched []VMParams
+		for _, vm := range vms {
+			if match(vm.Name) {
+				matched = append(matched, vm)
+			}
+		}
+		vms = matched
+		slog.Info("Filtered rows by name", "event", "rows_filtered", "filter", cfg.NameFilter, "total", total, "matched", len(vms))
+	}
+
+	if cfg.Offset != 0 || cfg.Limit != 0 {
+		total := len(vms)
+		vms, err = selectRows(vms, cfg.Offset, cfg.Limit)
+		if err != nil {
+			fatal("Invalid --offset or --limit", err)
+		}
+		if len(vms) == 0 {
+			slog.Warn("No rows selected", "event", "rows_selected", "total", total, "offset", cfg.Offset, "limit", cfg.Limit)
+		} else {
+			slog.Info("Processing a subset of rows", "event", "rows_selected", "total", total, "selected", len(vms),
+				"first_line", vms[0].line, "last_line", vms[len(vms)-1].line)
+		}
+	}
+
+	// Rows left without a storage domain are spread over --storage-domains in input
+	// order. Assigning them here, before any worker starts, keeps it deterministic.
+	if len(cfg.StorageDomains) > 0 {
+		if cfg.StorageDomain != "" {
+			fatal("Invalid storage domain settings", errors.New("--storage-domain and --storage-domains are mutually exclusive"))
+		}
+		next := 0
+		for i := range vms {
+			if vms[i].StorageDomain == "" {
+				vms[i].StorageDomain = cfg.StorageDomains[next%len(cfg.StorageDomains)]
+				next++
+			}
+		}
+		slog.Info("Spread VMs over storage domains", "event", "storage_domains_assigned", "storage_domains", cfg.StorageDomains.String(), "vms", next)
+	}
+
+	if cfg.Concurrency < 1 {
+		fatal("Invalid --concurrency", fmt.Errorf("must be at least 1, got %d", cfg.Concurrency))
+	}
+	var concurrencyLimit *adaptiveLimit
+	if cfg.RateLimit < 0 {
+		fatal("Invalid --rate-limit", fmt.Errorf("must not be negative, got %g", cfg.RateLimit))
+	}
+	if cfg.AdaptiveConcurrency {
+		if cfg.MinConcurrency < 1 || cfg.MinConcurrency > cfg.Concurrency {
+			fatal("Invalid --min-concurrency", fmt.Errorf("must be between 1 and --concurrency (%d), got %d", cfg.Concurrency, cfg.MinConcurrency))
+		}
+		if cfg.MinConcurrency < cfg.Concurrency {
+			concurrencyLimit = newAdaptiveLimit(cfg.MinConcurrency, cfg.Concurrency)
+		}
+	}
+
+	// Rows are grouped by their Engine column, with a pool and lookup cache per engine
+	engines, err := engineRuns(cfg, vms, cfg.Connections, apiTimeout)
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		problems := joined.Unwrap()
+		for _, problem := range problems {
+			slog.Error("Unknown engine", "event", "unknown_engine", "error", problem)
+		}
+		fatal("Invalid Engine column", fmt.Errorf("%d unknown engines", len(problems)))
+	}
+	if err != nil {
+		fatal("Failed to create connection to the oVirt engine", err)
+	}
+	defer closeEngines(engines)
+	byEngine := make(map[string]*engineRun, len(engines))
+	for _, engine := range engines {
+		byEngine[engine.name] = engine
+	}
+
+	if cfg.AutoStorage && !*deleteMode {
+		if cfg.StorageDomain != "" || len(cfg.StorageDomains) > 0 {
+			closeEngines(engines)
+			fatal("Invalid storage domain settings", errors.New("--auto-storage cannot be combined with --storage-domain or --storage-domains"))
+		}
+		var problems []error
+		for _, engine := range engines {
+			rows := engine.subset(vms)
+			engineProblems, err := autoPlaceStorage(engine.pool.get(), engine.lookups, rows)
+			if err != nil {
+				closeEngines(engines)
+				fatal("Failed to place VMs on storage domains", fmt.Errorf("engine %s: %w", engine.label(), err))
+			}
+			engine.store(vms, rows)
+			problems = append(problems, engineProblems...)
+		}
+		for _, problem := range problems {
+			logRowError(problem)
+		}
+		if len(problems) > 0 && !cfg.Force {
+			closeEngines(engines)
+			fatal("Storage placement failed", fmt.Errorf("%d VMs do not fit on any storage domain; use --force to create the remaining VMs anyway", len(problems)))
+		}
+	}
+
+	// Catch misspelled references before any VM is created
+	if !*deleteMode {
+		var problems []error
+		for _, engine := range engines {
+			problems = append(problems, preflight(engine.pool.get(), engine.subset(vms), engine.lookups)...)
+		}
+		for _, problem := range problems {
+			slog.Error("Missing reference", "event", "missing_reference", "error", problem)
+		}
+		if len(problems) > 0 {
+			if !cfg.Force {
+				closeEngines(engines)
+				fatal("Pre-flight validation failed", fmt.Errorf("%d references not found; use --force to create the remaining VMs anyway", len(problems)))
+			}
+			slog.Warn("Pre-flight validation failed, continuing because of --force", "event", "preflight_forced", "problems", len(problems))
+		}
+	}
+
+	opts := createOptions{
+		DryRun:         cfg.DryRun,
+		Start:          cfg.Start,
+		CreateTimeout:  time.Duration(cfg.CreateTimeout),
+		StartTimeout:   time.Duration(cfg.StartTimeout),
+		GuestIPTimeout: time.Duration(cfg.GuestIPTimeout),
+		Snapshot:       cfg.SnapshotAfter,
+		SealToTemplate: cfg.SealToTemplate,
+		MaxRetries:     cfg.MaxRetries,
+		Force:          cfg.Force,
+		DetachOnly:     cfg.DetachOnly,
+
+		AffinityPositive:  cfg.AffinityPositive,
+		AffinityEnforcing: cfg.AffinityEnforcing,
+	}
+
+	if cfg.PrintCloudInit {
+		opts.CloudInitOut = os.Stdout
+	}
+	// A burst of 1 spaces the calls out evenly instead of letting idle time pile up
+	if cfg.RateLimit > 0 {
+		opts.RateLimit = rate.NewLimiter(rate.Limit(cfg.RateLimit), 1)
+	}
+
+	errs := &errorLog{}
+
+	worker := createVM
+	if *deleteMode {
+		worker = deleteVM
+	}
+
+	// The first SIGINT or SIGTERM stops new VMs from being started; VMs already
+	// talking to the engine finish their current call. A second signal kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	timeout := time.Duration(cfg.Timeout)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	ctx, cancelRun := context.WithCancelCause(ctx)
+	defer cancelRun(nil)
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+			if errors.Is(context.Cause(ctx), errStoppedOnError) {
+				slog.Warn("A VM failed, stopping the run; waiting for in-flight VMs", "event", "stopped_on_error")
+			} else if ctx.Err() == context.DeadlineExceeded {
+				slog.Warn("Run timed out, waiting for in-flight VMs", "event", "timed_out", "timeout", timeout)
+			} else {
+				slog.Warn("Interrupted, waiting for in-flight VMs; interrupt again to exit immediately", "event", "interrupted")
+			}
+		case <-finished:
+		}
+	}()
+
+	runStart := time.Now()
+	progress := newProgress(vms)
+	stopProgress := progress.logEvery(progressInterval)
+
+	waited := startWorkers(ctx, vms, cfg.Concurrency, concurrencyLimit, progress, func(ctx context.Context, vmParams VMParams) vmResult {
+		engine := byEngine[vmParams.Engine]
+		engineOpts := opts
+		engineOpts.Lookups = engine.lookups
+		began := time.Now()
+		result := worker(ctx, vmParams, engine.pool.get(), engineOpts, errs)
+		result.Seconds = time.Since(began).Seconds()
+		if cfg.StopOnError && result.Status == statusFailed {
+			cancelRun(errStoppedOnError)
+		}
+		return result
+	})
+	select {
+	case <-waited:
+	case <-ctx.Done():
+		// SDK calls can't be cancelled, so after a timeout give them a grace
+		// period and then stop waiting rather than hang on a stuck engine
+		var grace <-chan time.Time
+		if ctx.Err() == context.DeadlineExceeded {
+			grace = time.After(shutdownGrace)
+		}
+		select {
+		case <-waited:
+		case <-grace:
+		}
+	}
+	close(finished)
+	stopProgress()
+
+	results := progress.results()
+	var pending []string
+	for _, result := range results {
+		if result.Status == statusPending || result.Status == statusCancelled {
+			pending = append(pending, result.Name)
+		}
+	}
+	if len(pending) > 0 {
+		slog.Warn("VMs left unfinished", "event", "pending", "vms", strings.Join(pending, ", "))
+	}
+
+	// Workers abandoned after a timeout may still add to errs; they are
+	// reported as pending and their later errors are dropped
+	for _, err := range errs.all() {
+		logRowError(err)
+	}
+
+	if cfg.ReportFile != "" {
+		if err := writeReport(cfg.ReportFile, results); err != nil {
+			slog.Error("Failed to write report", "event", "report_failed", "error", err)
+		}
+	}
+	if cfg.MetricsFile != "" {
+		if err := writeMetrics(cfg.MetricsFile, results, time.Since(runStart)); err != nil {
+			slog.Error("Failed to write metrics", "event", "metrics_failed", "error", err)
+		}
+	}
+	if cfg.OutputCSV != "" {
+		if err := writeResultsCSV(cfg.OutputCSV, vms, results); err != nil {
+			slog.Error("Failed to write output CSV", "event", "output_csv_failed", "error", err)
+		}
+	}
+
+	verb := "created"
+	switch {
+	case cfg.DryRun:
+		verb = "validated"
+	case *deleteMode:
+		verb = "deleted"
+	}
+	var engineLookups, cacheHits int64
+	for _, engine := range engines {
+		lookups, hits := engine.lookups.stats()
+		engineLookups += lookups
+		cacheHits += hits
+	}
+	slog.Debug("Lookup cache", "event", "lookup_cache", "lookups", engineLookups, "hits", cacheHits)
+
+	logDurations(results)
+	summary, failed := summarize(results, verb)
+	slog.Info(summary, "event", "summary", "total", len(results), "failed", failed)
+	// The table would end up in the middle of the printed cloud-configs
+	if !cfg.NoSummary && !cfg.PrintCloudInit {
+		if err := printSummaryTable(os.Stdout, results); err != nil {
+			slog.Error("Failed to print summary table", "event", "summary_table_failed", "error", err)
+		}
+	}
+	if failed > 0 || ctx.Err() != nil {
+		closeEngines(engines) // os.Exit skips deferred calls
+		os.Exit(1)
+	}
+}
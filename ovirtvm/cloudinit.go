@@ -0,0 +1,263 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+	"gopkg.in/yaml.v3"
+)
+
+// Boot protocols accepted in the BootProto column.
+const (
+	bootProtoStatic = "static"
+	bootProtoDHCP   = "dhcp"
+)
+
+// defaultGuestNic is the guest interface configured when the Nic column is
+// empty. It matches the classic naming most cloud images still use for
+// their first virtio NIC.
+const defaultGuestNic = "eth0"
+
+// guestNicName matches the interface names Linux guests commonly use: the
+// classic ethN and the systemd predictable names (eno1, ens3, enp1s0, enx...).
+var guestNicName = regexp.MustCompile(`^(eth[0-9]+|en[ospx][0-9a-z]+)$`)
+
+// searchDomainPattern matches a DNS domain name: dot-separated labels of
+// letters, digits and inner hyphens, with an optional trailing dot.
+var searchDomainPattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?\.)*[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?\.?$`)
+
+// plausibleGuestNic reports whether name looks like a Linux interface name.
+func plausibleGuestNic(name string) bool {
+	return guestNicName.MatchString(name)
+}
+
+// guestNicProblem returns why name can never be a Linux interface name, or ""
+// if it could be one. These are the kernel's own rules: at most 15 bytes, not
+// "." or "..", and no slash, colon or whitespace. Names that pass can still be
+// unusual, which plausibleGuestNic reports.
+func guestNicProblem(name string) string {
+	switch {
+	case name == "" || name == "." || name == "..":
+		return fmt.Sprintf("invalid Nic %q", name)
+	case len(name) > 15:
+		return fmt.Sprintf("invalid Nic %q: longer than 15 bytes", name)
+	case strings.ContainsAny(name, "/:") || strings.IndexFunc(name, unicode.IsSpace) >= 0:
+		return fmt.Sprintf("invalid Nic %q: must not contain slashes, colons or whitespace", name)
+	}
+	return ""
+}
+
+// parseBootProto validates the BootProto column. When it is empty, rows with
+// an IPv4 or IPv6 address use static addressing and all other rows use DHCP.
+func parseBootProto(value, ip, ipv6 string) (string, error) {
+	switch strings.ToLower(value) {
+	case "":
+		if ip == "" && ipv6 == "" {
+			return bootProtoDHCP, nil
+		}
+		return bootProtoStatic, nil
+	case bootProtoStatic:
+		return bootProtoStatic, nil
+	case bootProtoDHCP:
+		return bootProtoDHCP, nil
+	}
+	return "", fmt.Errorf("unknown boot protocol %q (valid: static, dhcp)", value)
+}
+
+// The types below mirror the cloud-init network config (version 1) so the
+// script can be produced by a YAML marshaller instead of string templating.
+type cloudConfigDocument struct {
+	Networking cloudNetworking `yaml:"networking"`
+}
+
+type cloudNetworking struct {
+	Version        int              `yaml:"version"`
+	Config         []cloudInterface `yaml:"config"`
+	DNSNameservers []string         `yaml:"dns_nameservers,omitempty"`
+	DNSSearch      []string         `yaml:"dns_search,omitempty"`
+}
+
+type cloudInterface struct {
+	Type    string        `yaml:"type"`
+	Name    string        `yaml:"name"`
+	Subnets []cloudSubnet `yaml:"subnets"`
+}
+
+type cloudSubnet struct {
+	Type    string `yaml:"type"`
+	Address string `yaml:"address,omitempty"`
+	Netmask string `yaml:"netmask,omitempty"`
+	Gateway string `yaml:"gateway,omitempty"`
+}
+
+// cloudConfigHeader marks user-data that cloud-init parses as cloud-config.
+const cloudConfigHeader = "#cloud-config"
+
+// userDataMapping parses user-data from a CloudInitFile. It returns nil for
+// files that are not cloud-config (shell scripts, MIME archives, ...), which
+// are passed to the VM unchanged.
+func userDataMapping(userData string) (*yaml.Node, error) {
+	if !strings.HasPrefix(userData, cloudConfigHeader) {
+		return nil, nil
+	}
+	// The header is re-added when rendering, so drop it rather than keep it as a comment
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(strings.TrimPrefix(userData, cloudConfigHeader)), &doc); err != nil {
+		return nil, fmt.Errorf("invalid cloud-config: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("invalid cloud-config: top level must be a mapping")
+	}
+	return doc.Content[0], nil
+}
+
+// cloudConfig renders the cloud-init network configuration for the VM. Static
+// rows get an IPv4 subnet when IP is set and an IPv6 subnet when IPv6 is set,
+// so a VM can be IPv4-only, IPv6-only or dual-stack.
+//
+// User-data from the CloudInitFile column is merged in: every top-level key of
+// a cloud-config file is kept, and the generated networking section is only
+// added when the file does not define its own. Any other kind of user-data
+// replaces the generated config entirely.
+func cloudConfig(vmParams VMParams) (string, error) {
+	userData, err := userDataMapping(vmParams.UserData)
+	if err != nil {
+		return "", err
+	}
+	if vmParams.UserData != "" && userData == nil {
+		return vmParams.UserData, nil
+	}
+
+	iface := cloudInterface{Type: "physical", Name: vmParams.Nic}
+	if vmParams.BootProto == bootProtoDHCP {
+		iface.Subnets = append(iface.Subnets, cloudSubnet{Type: "dhcp"})
+	} else if vmParams.IP != "" {
+		iface.Subnets = append(iface.Subnets, cloudSubnet{
+			Type:    "static",
+			Address: vmParams.IP,
+			Netmask: vmParams.Mask,
+			Gateway: vmParams.Gateway,
+		})
+	}
+	if vmParams.IPv6 != "" {
+		iface.Subnets = append(iface.Subnets, cloudSubnet{
+			Type:    "static6",
+			Address: fmt.Sprintf("%s/%d", vmParams.IPv6, vmParams.IPv6Prefix),
+			Gateway: vmParams.IPv6Gateway,
+		})
+	}
+
+	doc := cloudConfigDocument{
+		Networking: cloudNetworking{
+			Version:   1,
+			Config:    []cloudInterface{iface},
+			DNSSearch: vmParams.SearchDomains,
+		},
+	}
+	if vmParams.BootProto == bootProtoStatic {
+		doc.Networking.DNSNameservers = vmParams.DNS
+	}
+
+	var out interface{} = doc
+	if userData != nil {
+		if !hasKey(userData, "networking") {
+			var generated yaml.Node
+			if err := generated.Encode(doc); err != nil {
+				return "", fmt.Errorf("failed to render cloud-config: %w", err)
+			}
+			userData.Content = append(userData.Content, generated.Content...)
+		}
+		out = userData
+	}
+
+	var b strings.Builder
+	b.WriteString(cloudConfigHeader + "\n")
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(out); err != nil {
+		return "", fmt.Errorf("failed to render cloud-config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("failed to render cloud-config: %w", err)
+	}
+	return b.String(), nil
+}
+
+// printCloudConfig writes the user-data injected into the VM to w, after a
+// comment line naming the VM and its input line. It is written with a single
+// Write call so previews from concurrent workers never interleave.
+func printCloudConfig(w io.Writer, vmParams VMParams, script string) error {
+	var b strings.Builder
+	if vmParams.line > 0 {
+		fmt.Fprintf(&b, "# ==> %s (line %d) <==\n", vmParams.Name, vmParams.line)
+	} else {
+		fmt.Fprintf(&b, "# ==> %s <==\n", vmParams.Name)
+	}
+	b.WriteString(script)
+	if !strings.HasSuffix(script, "\n") {
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// usesGeneratedNetworking reports whether the VM's cloud-config includes the
+// networking section built from the row, which is where Nic is used.
+func usesGeneratedNetworking(vmParams VMParams) bool {
+	if vmParams.UserData == "" {
+		return true
+	}
+	userData, err := userDataMapping(vmParams.UserData)
+	if err != nil || userData == nil {
+		return false
+	}
+	return !hasKey(userData, "networking")
+}
+
+// hasKey reports whether the YAML mapping node has the given key.
+func hasKey(mapping *yaml.Node, key string) bool {
+	for i := 0; i < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return true
+		}
+	}
+	return false
+}
+
+// newCloudInitBuilder builds the initialization for a Linux guest from the
+// row's cloud-config, host name, SSH keys and root password. The rendered
+// cloud-config is also printed to out when it is set.
+func newCloudInitBuilder(vmParams VMParams, out io.Writer, logger *slog.Logger, warn func(error)) (*ovirtsdk4.InitializationBuilder, error) {
+	customScript, err := cloudConfig(vmParams)
+	if err != nil {
+		return nil, err
+	}
+	// cloud-init skips config for devices the guest doesn't have, so a wrong name fails silently
+	if usesGeneratedNetworking(vmParams) && !plausibleGuestNic(vmParams.Nic) {
+		warn(fmt.Errorf("VM %s: nic %q does not look like a Linux interface name (eth0, ens3, enp1s0, ...); the network config will not apply unless the guest has it", vmParams.Name, vmParams.Nic))
+	}
+	logger.Debug("Generated cloud-config", "event", "cloud_config", "cloud_config", customScript)
+	if out != nil {
+		if err := printCloudConfig(out, vmParams, customScript); err != nil {
+			logger.Warn("Failed to print cloud-config", "event", "cloud_config_print_failed", "error", err)
+		}
+	}
+	initializationBuilder := ovirtsdk4.NewInitializationBuilder().
+		HostName(vmParams.Hostname).
+		CustomScript(customScript)
+	if len(vmParams.SSHKeys) > 0 {
+		initializationBuilder.AuthorizedSshKeys(strings.Join(vmParams.SSHKeys, "\n"))
+	}
+	if vmParams.RootPassword != "" {
+		initializationBuilder.RootPassword(string(vmParams.RootPassword))
+	}
+	return initializationBuilder, nil
+}
@@ -0,0 +1,333 @@
+package ovirtvm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestCloudConfigIsValidYAML renders cloud-configs whose values need quoting
+// or block scalars and checks that they parse back to the same values.
+func TestCloudConfigIsValidYAML(t *testing.T) {
+	keys := []string{
+		"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBbB user@host: \"ops\" # primary",
+		"ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQ backup's key",
+	}
+	userData := cloudConfigHeader + `
+ssh_authorized_keys:
+  - "` + strings.ReplaceAll(keys[0], `"`, `\"`) + `"
+  - "` + keys[1] + `"
+write_files:
+  - path: /etc/motd
+    content: |
+      Welcome: "prod" # do not edit
+      second line
+`
+
+	vm := VMParams{
+		Name:          "web1",
+		Nic:           "eth0",
+		BootProto:     bootProtoStatic,
+		IP:            "192.0.2.10",
+		Mask:          "255.255.255.0",
+		Gateway:       "192.0.2.1",
+		IPv6:          "2001:db8::10",
+		IPv6Prefix:    64,
+		IPv6Gateway:   "2001:db8::1",
+		DNS:           []string{"192.0.2.53", "2001:db8::53"},
+		SearchDomains: []string{"example.com", "corp.example.com"},
+		UserData:      userData,
+	}
+	script, err := cloudConfig(vm)
+	if err != nil {
+		t.Fatalf("cloudConfig: %v", err)
+	}
+	if !strings.HasPrefix(script, cloudConfigHeader+"\n") {
+		t.Errorf("script does not start with %q:\n%s", cloudConfigHeader, script)
+	}
+	if strings.Contains(script, "\t") {
+		t.Errorf("script contains tabs:\n%s", script)
+	}
+
+	var got struct {
+		SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys"`
+		WriteFiles        []struct {
+			Path    string `yaml:"path"`
+			Content string `yaml:"content"`
+		} `yaml:"write_files"`
+		Networking cloudNetworking `yaml:"networking"`
+	}
+	if err := yaml.Unmarshal([]byte(script), &got); err != nil {
+		t.Fatalf("rendered cloud-config is not valid YAML: %v\n%s", err, script)
+	}
+
+	if !reflect.DeepEqual(got.SSHAuthorizedKeys, keys) {
+		t.Errorf("ssh_authorized_keys = %q, want %q", got.SSHAuthorizedKeys, keys)
+	}
+	wantContent := "Welcome: \"prod\" # do not edit\nsecond line\n"
+	if len(got.WriteFiles) != 1 || got.WriteFiles[0].Content != wantContent {
+		t.Errorf("write_files = %+v, want one file with content %q", got.WriteFiles, wantContent)
+	}
+
+	want := cloudNetworking{
+		Version: 1,
+		Config: []cloudInterface{{
+			Type: "physical",
+			Name: "eth0",
+			Subnets: []cloudSubnet{
+				{Type: "static", Address: "192.0.2.10", Netmask: "255.255.255.0", Gateway: "192.0.2.1"},
+				{Type: "static6", Address: "2001:db8::10/64", Gateway: "2001:db8::1"},
+			},
+		}},
+		DNSNameservers: []string{"192.0.2.53", "2001:db8::53"},
+		DNSSearch:      []string{"example.com", "corp.example.com"},
+	}
+	if !reflect.DeepEqual(got.Networking, want) {
+		t.Errorf("networking = %+v, want %+v", got.Networking, want)
+	}
+}
+
+// TestCloudConfig checks the networking generated for each kind of row and
+// how user-data from a CloudInitFile is combined with it.
+func TestCloudConfig(t *testing.T) {
+	const shellScript = "#!/bin/sh\necho hello\n"
+	tests := []struct {
+		name string
+		vm   VMParams
+		// Exactly one of want and wantScript is set: the parsed networking
+		// section, or the verbatim script for user-data passed through.
+		want       *cloudNetworking
+		wantScript string
+	}{
+		{
+			name: "dhcp ignores DNS",
+			vm:   VMParams{Nic: "eth0", BootProto: bootProtoDHCP, DNS: []string{"192.0.2.53"}},
+			want: &cloudNetworking{
+				Version: 1,
+				Config:  []cloudInterface{{Type: "physical", Name: "eth0", Subnets: []cloudSubnet{{Type: "dhcp"}}}},
+			},
+		},
+		{
+			name: "static IPv4 with DNS",
+			vm: VMParams{
+				Nic: "ens3", BootProto: bootProtoStatic,
+				IP: "192.0.2.10", Mask: "255.255.255.0", Gateway: "192.0.2.1",
+				DNS: []string{"192.0.2.53", "192.0.2.54"}, SearchDomains: []string{"example.com"},
+			},
+			want: &cloudNetworking{
+				Version: 1,
+				Config: []cloudInterface{{Type: "physical", Name: "ens3", Subnets: []cloudSubnet{
+					{Type: "static", Address: "192.0.2.10", Netmask: "255.255.255.0", Gateway: "192.0.2.1"},
+				}}},
+				DNSNameservers: []string{"192.0.2.53", "192.0.2.54"},
+				DNSSearch:      []string{"example.com"},
+			},
+		},
+		{
+			name: "static without DNS servers",
+			vm: VMParams{
+				Nic: "eth0", BootProto: bootProtoStatic,
+				IP: "192.0.2.10", Mask: "255.255.255.0", Gateway: "192.0.2.1",
+			},
+			want: &cloudNetworking{
+				Version: 1,
+				Config: []cloudInterface{{Type: "physical", Name: "eth0", Subnets: []cloudSubnet{
+					{Type: "static", Address: "192.0.2.10", Netmask: "255.255.255.0", Gateway: "192.0.2.1"},
+				}}},
+			},
+		},
+		{
+			name: "static IPv6 only",
+			vm: VMParams{
+				Nic: "eth0", BootProto: bootProtoStatic,
+				IPv6: "2001:db8::10", IPv6Prefix: 56, IPv6Gateway: "2001:db8::1",
+				DNS: []string{"2001:db8::53"},
+			},
+			want: &cloudNetworking{
+				Version: 1,
+				Config: []cloudInterface{{Type: "physical", Name: "eth0", Subnets: []cloudSubnet{
+					{Type: "static6", Address: "2001:db8::10/56", Gateway: "2001:db8::1"},
+				}}},
+				DNSNameservers: []string{"2001:db8::53"},
+			},
+		},
+		{
+			name:       "non cloud-config user-data is passed through",
+			vm:         VMParams{Nic: "eth0", BootProto: bootProtoDHCP, UserData: shellScript},
+			wantScript: shellScript,
+		},
+		{
+			name: "user-data networking wins",
+			vm: VMParams{
+				Nic: "eth0", BootProto: bootProtoStatic, IP: "192.0.2.10", Mask: "255.255.255.0", Gateway: "192.0.2.1",
+				UserData: cloudConfigHeader + "\nnetworking:\n  version: 1\n  config:\n    - type: physical\n      name: eth1\n      subnets:\n        - type: dhcp\n",
+			},
+			want: &cloudNetworking{
+				Version: 1,
+				Config:  []cloudInterface{{Type: "physical", Name: "eth1", Subnets: []cloudSubnet{{Type: "dhcp"}}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := cloudConfig(tt.vm)
+			if err != nil {
+				t.Fatalf("cloudConfig: %v", err)
+			}
+			if tt.want == nil {
+				if script != tt.wantScript {
+					t.Errorf("script = %q, want %q", script, tt.wantScript)
+				}
+				return
+			}
+			var got cloudConfigDocument
+			if err := yaml.Unmarshal([]byte(script), &got); err != nil {
+				t.Fatalf("rendered cloud-config is not valid YAML: %v\n%s", err, script)
+			}
+			if !reflect.DeepEqual(got.Networking, *tt.want) {
+				t.Errorf("networking = %+v, want %+v\n%s", got.Networking, *tt.want, script)
+			}
+		})
+	}
+}
+
+// TestCloudConfigRejectsInvalidUserData checks that a broken cloud-config
+// file is reported rather than sent to the VM.
+func TestCloudConfigRejectsInvalidUserData(t *testing.T) {
+	for _, userData := range []string{
+		cloudConfigHeader + "\npackages: [unclosed\n",
+		cloudConfigHeader + "\n- a list\n- not a mapping\n",
+	} {
+		if _, err := cloudConfig(VMParams{Nic: "eth0", BootProto: bootProtoDHCP, UserData: userData}); err == nil {
+			t.Errorf("cloudConfig accepted user-data %q", userData)
+		}
+	}
+}
+
+// TestCloudConfigEscapesValues renders rows whose values would break YAML
+// if interpolated as-is and checks that they parse back unchanged. It calls
+// cloudConfig directly, since validation normally rejects most of them.
+func TestCloudConfigEscapesValues(t *testing.T) {
+	tests := []struct {
+		name string
+		vm   VMParams
+	}{
+		{
+			name: "colons",
+			vm: VMParams{
+				Nic: "eth0: {}", BootProto: bootProtoStatic,
+				IP: "192.0.2.10", Mask: "255.255.255.0", Gateway: "192.0.2.1",
+				DNS:           []string{"2001:db8::53", "key: value"},
+				SearchDomains: []string{"a:b.example.com"},
+			},
+		},
+		{
+			name: "quotes and comments",
+			vm: VMParams{
+				Nic: `"eth0"`, BootProto: bootProtoStatic,
+				IP: "192.0.2.10", Mask: "255.255.255.0", Gateway: `'192.0.2.1' # gw`,
+				DNS:           []string{`"192.0.2.53"`, `a'b"c`, "# not a comment"},
+				SearchDomains: []string{`example.com"`, "'corp'"},
+			},
+		},
+		{
+			name: "newlines",
+			vm: VMParams{
+				Nic: "eth0\nnetworking: {}", BootProto: bootProtoStatic,
+				IPv6: "2001:db8::10", IPv6Prefix: 64, IPv6Gateway: "2001:db8::1\n- injected",
+				DNS:           []string{"192.0.2.53\n  - 198.51.100.1", "trailing\n", "x\ndns_nameservers: [evil]"},
+				SearchDomains: []string{"example.com\ndns_search: [evil.example]"},
+			},
+		},
+		{
+			name: "YAML indicators",
+			vm: VMParams{
+				Nic: "- eth0", BootProto: bootProtoStatic, IP: "&anchor", Mask: "*alias", Gateway: "!tag",
+				DNS:           []string{"{a: b}", "[x]", "|"},
+				SearchDomains: []string{"&anchor", "*alias", "!tag", "{a: b}", "[x]", "|", ">", "null", "yes", "0x10", ""},
+			},
+		},
+		{
+			name: "YAML scalars",
+			vm: VMParams{
+				Nic: "null", BootProto: bootProtoStatic, IP: "yes", Mask: "0x10", Gateway: "~",
+				DNS: []string{">", "1e3", ""},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := cloudConfig(tt.vm)
+			if err != nil {
+				t.Fatalf("cloudConfig: %v", err)
+			}
+			var got cloudConfigDocument
+			if err := yaml.Unmarshal([]byte(script), &got); err != nil {
+				t.Fatalf("rendered cloud-config is not valid YAML: %v\n%s", err, script)
+			}
+
+			networking := got.Networking
+			if len(networking.Config) != 1 {
+				t.Fatalf("got %d interfaces, want 1\n%s", len(networking.Config), script)
+			}
+			if name := networking.Config[0].Name; name != tt.vm.Nic {
+				t.Errorf("interface name = %q, want %q", name, tt.vm.Nic)
+			}
+			var gateways []string
+			for _, subnet := range networking.Config[0].Subnets {
+				if subnet.Gateway != "" {
+					gateways = append(gateways, subnet.Gateway)
+				}
+			}
+			var wantGateways []string
+			for _, gateway := range []string{tt.vm.Gateway, tt.vm.IPv6Gateway} {
+				if gateway != "" {
+					wantGateways = append(wantGateways, gateway)
+				}
+			}
+			if !reflect.DeepEqual(gateways, wantGateways) {
+				t.Errorf("gateways = %q, want %q", gateways, wantGateways)
+			}
+			var wantDNS []string
+			if tt.vm.BootProto == bootProtoStatic {
+				wantDNS = tt.vm.DNS
+			}
+			if !reflect.DeepEqual(networking.DNSNameservers, wantDNS) {
+				t.Errorf("dns_nameservers = %q, want %q", networking.DNSNameservers, wantDNS)
+			}
+			if !reflect.DeepEqual(networking.DNSSearch, tt.vm.SearchDomains) {
+				t.Errorf("dns_search = %q, want %q", networking.DNSSearch, tt.vm.SearchDomains)
+			}
+		})
+	}
+}
+
+// TestGuestNicProblem checks which Nic values are rejected outright because
+// no Linux guest can have an interface of that name.
+func TestGuestNicProblem(t *testing.T) {
+	tests := []struct {
+		nic  string
+		want bool // Whether a problem is reported
+	}{
+		{"eth0", false},
+		{"enp1s0", false},
+		{"bond0.100", false}, // Unusual, so only warned about when creating the VM
+		{`"eth0"`, false},
+		{"", true},
+		{".", true},
+		{"..", true},
+		{"eth0: x", true},
+		{"eth0:1", true},
+		{"eth0\nnetworking: {}", true},
+		{"eth 0", true},
+		{"net/eth0", true},
+		{"averyverylongnic0", true},
+	}
+	for _, tt := range tests {
+		if got := guestNicProblem(tt.nic); (got != "") != tt.want {
+			t.Errorf("guestNicProblem(%q) = %q, want a problem: %t", tt.nic, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// findDataCenter looks up a data center by ID or by name.
+func findDataCenter(conn *ovirtsdk4.Connection, name string) (*ovirtsdk4.DataCenter, error) {
+	dataCentersService := conn.SystemService().DataCentersService()
+	if isID(name) {
+		resp, err := dataCentersService.DataCenterService(name).Get().Send()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve data center %s: %w", name, err)
+		}
+		dataCenter, ok := resp.DataCenter()
+		if !ok {
+			return nil, fmt.Errorf("data center %s not found", name)
+		}
+		return dataCenter, nil
+	}
+
+	resp, err := dataCentersService.List().Search("name=" + name).Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve data center %s: %w", name, err)
+	}
+	dataCenters, ok := resp.DataCenters()
+	if !ok || len(dataCenters.Slice()) == 0 {
+		return nil, fmt.Errorf("data center %s not found", name)
+	}
+	return dataCenters.Slice()[0], nil
+}
+
+// clusterKey identifies a cluster reference, which is only unique together
+// with the data center it is restricted to.
+func clusterKey(name, dataCenter string) string {
+	if dataCenter == "" {
+		return name
+	}
+	return dataCenter + "/" + name
+}
+
+// findCluster looks up a cluster by ID or by name. A non-empty dataCenter
+// restricts names to the clusters of that data center and rejects a cluster
+// ID from another one. A name still shared by several clusters is rejected so
+// the row can be given an ID instead.
+func findCluster(conn *ovirtsdk4.Connection, name, dataCenter string) (*ovirtsdk4.Cluster, error) {
+	var dataCenterID string
+	if dataCenter != "" {
+		dc, err := findDataCenter(conn, dataCenter)
+		if err != nil {
+			return nil, err
+		}
+		dataCenterID, _ = dc.Id()
+	}
+	inDataCenter := func(cluster *ovirtsdk4.Cluster) bool {
+		if dataCenterID == "" {
+			return true
+		}
+		clusterDataCenter, ok := cluster.DataCenter()
+		if !ok {
+			return false
+		}
+		id, _ := clusterDataCenter.Id()
+		return id == dataCenterID
+	}
+
+	clustersService := conn.SystemService().ClustersService()
+	if isID(name) {
+		resp, err := clustersService.ClusterService(name).Get().Send()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve cluster %s: %w", name, err)
+		}
+		cluster, ok := resp.Cluster()
+		if !ok {
+			return nil, fmt.Errorf("cluster %s not found", name)
+		}
+		if !inDataCenter(cluster) {
+			return nil, fmt.Errorf("cluster %s is not in data center %s", name, dataCenter)
+		}
+		return cluster, nil
+	}
+
+	clustersResponse, err := clustersService.List().Search("name=" + name).Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve cluster %s: %w", name, err)
+	}
+	var clusters []*ovirtsdk4.Cluster
+	if clusterSlice, ok := clustersResponse.Clusters(); ok {
+		for _, cluster := range clusterSlice.Slice() {
+			if inDataCenter(cluster) {
+				clusters = append(clusters, cluster)
+			}
+		}
+	}
+	if len(clusters) == 0 {
+		if dataCenter != "" {
+			return nil, fmt.Errorf("cluster %s not found in data center %s", name, dataCenter)
+		}
+		return nil, fmt.Errorf("cluster %s not found", name)
+	}
+	if len(clusters) > 1 {
+		var ids []string
+		for _, cluster := range clusters {
+			id, _ := cluster.Id()
+			ids = append(ids, id)
+		}
+		return nil, fmt.Errorf("cluster name %s matches %d clusters (IDs: %s); use the cluster ID or set DataCenter", name, len(clusters), strings.Join(ids, ", "))
+	}
+	return clusters[0], nil
+}
+
+// findHost looks up the named host and checks that it belongs to the cluster.
+func findHost(conn *ovirtsdk4.Connection, cluster *ovirtsdk4.Cluster, name string) (*ovirtsdk4.Host, error) {
+	hostsResponse, err := conn.SystemService().HostsService().List().Search("name=" + name).Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve host %s: %w", name, err)
+	}
+	hosts, ok := hostsResponse.Hosts()
+	if !ok || len(hosts.Slice()) == 0 {
+		return nil, fmt.Errorf("host %s not found", name)
+	}
+	host := hosts.Slice()[0]
+
+	clusterID, _ := cluster.Id()
+	clusterName, _ := cluster.Name()
+	hostCluster, ok := host.Cluster()
+	if !ok {
+		return nil, fmt.Errorf("host %s is not in a cluster", name)
+	}
+	if id, _ := hostCluster.Id(); id != clusterID {
+		return nil, fmt.Errorf("host %s does not belong to cluster %s", name, clusterName)
+	}
+	return host, nil
+}
+
+// clusterCPUTypes returns the names of the CPU types supported at the
+// cluster's compatibility level.
+func clusterCPUTypes(conn *ovirtsdk4.Connection, cluster *ovirtsdk4.Cluster) ([]string, error) {
+	version, ok := cluster.Version()
+	if !ok {
+		return nil, fmt.Errorf("cluster has no compatibility version")
+	}
+	major, _ := version.Major()
+	minor, _ := version.Minor()
+	resp, err := conn.SystemService().ClusterLevelsService().LevelService(fmt.Sprintf("%d.%d", major, minor)).Get().Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve cluster level %d.%d: %w", major, minor, err)
+	}
+	level, ok := resp.Level()
+	if !ok {
+		return nil, fmt.Errorf("cluster level %d.%d not found", major, minor)
+	}
+	var names []string
+	if cpuTypes, ok := level.CpuTypes(); ok {
+		for _, cpuType := range cpuTypes.Slice() {
+			if name, ok := cpuType.Name(); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// resolvePinnedHost looks up the host the row pins its VM to and returns its
+// ID, after checking that the host has the CPUs and NUMA nodes the row asks
+// for.
+func resolvePinnedHost(conn *ovirtsdk4.Connection, cluster *ovirtsdk4.Cluster, vmParams VMParams) (string, error) {
+	host, err := findHost(conn, cluster, vmParams.Host)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve host for VM %s: %w", vmParams.Name, err)
+	}
+	if len(vmParams.CPUPinning) > 0 {
+		if err := checkCPUPinning(host, vmParams.CPUPinning); err != nil {
+			return "", fmt.Errorf("invalid CPU pinning for VM %s: %w", vmParams.Name, err)
+		}
+	}
+	if vmParams.NumaNodes > 0 {
+		hostNodes, err := hostNumaNodeCount(conn, host)
+		if err != nil {
+			return "", fmt.Errorf("failed to inspect host %s for VM %s: %w", vmParams.Host, vmParams.Name, err)
+		}
+		if vmParams.NumaNodes > hostNodes {
+			return "", fmt.Errorf("VM %s wants %d NUMA nodes but host %s has %d", vmParams.Name, vmParams.NumaNodes, vmParams.Host, hostNodes)
+		}
+	}
+	id, _ := host.Id()
+	return id, nil
+}
@@ -0,0 +1,110 @@
+package ovirtvm
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Tuning of the adaptive concurrency limit.
+const (
+	// slowFactor marks a VM as slow when it took this many times the
+	// smoothed duration of earlier successful VMs
+	slowFactor = 2.0
+	// latencyWeight is the weight of each new duration in the smoothed average
+	latencyWeight = 0.2
+	// latencySamples is how many successes are averaged before durations are judged
+	latencySamples = 3
+)
+
+// adaptiveLimit bounds the number of VMs worked on at once and adjusts the
+// bound AIMD-style: it grows by one after a window of as many good results as
+// the current limit, and halves on a failure or on a VM that took much longer
+// than the recent average, both of which usually mean the engine is busy.
+type adaptiveLimit struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	min, max int
+	inFlight int
+	good     int     // Good results since the limit last changed
+	latency  float64 // Smoothed seconds per successful VM
+	samples  int
+}
+
+// newAdaptiveLimit starts at minLimit and never goes beyond maxLimit.
+func newAdaptiveLimit(minLimit, maxLimit int) *adaptiveLimit {
+	l := &adaptiveLimit{limit: minLimit, min: minLimit, max: maxLimit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits until fewer VMs than the limit are in flight. It returns
+// false if ctx is cancelled first.
+func (l *adaptiveLimit) acquire(ctx context.Context) bool {
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		l.cond.Broadcast()
+		l.mu.Unlock()
+	})
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.inFlight >= l.limit && ctx.Err() == nil {
+		l.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// release ends a VM started by acquire and adjusts the limit from its result.
+func (l *adaptiveLimit) release(result vmResult) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	defer l.cond.Broadcast()
+
+	switch result.Status {
+	case statusCancelled, statusPending:
+		return
+	case statusFailed:
+		l.decrease("failure")
+		return
+	}
+	// Slow VMs still feed the average, so a lasting slowdown becomes the new normal
+	slow := l.samples >= latencySamples && result.Seconds > slowFactor*l.latency
+	if l.samples == 0 {
+		l.latency = result.Seconds
+	} else {
+		l.latency += latencyWeight * (result.Seconds - l.latency)
+	}
+	l.samples++
+	if slow {
+		l.decrease("slow")
+		return
+	}
+
+	l.good++
+	if l.good >= l.limit && l.limit < l.max {
+		l.limit++
+		l.good = 0
+		slog.Info("Raised concurrency", "event", "concurrency_changed", "concurrency", l.limit, "avg_seconds", round(l.latency))
+	}
+}
+
+// decrease halves the limit, but not below the minimum.
+func (l *adaptiveLimit) decrease(reason string) {
+	l.good = 0
+	if l.limit == l.min {
+		return
+	}
+	l.limit /= 2
+	if l.limit < l.min {
+		l.limit = l.min
+	}
+	slog.Info("Lowered concurrency", "event", "concurrency_changed", "concurrency", l.limit, "reason", reason)
+}
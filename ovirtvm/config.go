@@ -0,0 +1,155 @@
+package ovirtvm
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings that can be supplied either on the command line
+// or through a --config file. Flags given on the command line take precedence.
+// Every flag has a key, except --config itself and the flags that choose what
+// a run does: --delete, --verify and the --list-* flags.
+type Config struct {
+	URL            string     `json:"url" yaml:"url"`
+	Username       string     `json:"username" yaml:"username"`
+	Password       string     `json:"password" yaml:"password"`
+	PasswordFile   string     `json:"password_file" yaml:"password_file"`
+	Insecure       bool       `json:"insecure" yaml:"insecure"`
+	CAFile         string     `json:"ca_file" yaml:"ca_file"`
+	Concurrency    int        `json:"concurrency" yaml:"concurrency"`
+	Connections    int        `json:"connections" yaml:"connections"`
+	CSVFile        string     `json:"csv_file" yaml:"csv_file"`
+	Format         string     `json:"format" yaml:"format"`
+	StorageDomain  string     `json:"storage_domain" yaml:"storage_domain"`
+	StorageDomains stringList `json:"storage_domains" yaml:"storage_domains"`
+	Network        string     `json:"network" yaml:"network"`
+	SSHKeyFile     string     `json:"ssh_key_file" yaml:"ssh_key_file"`
+	Header         bool       `json:"header" yaml:"header"`
+	Start          bool       `json:"start" yaml:"start"`
+	MaxRetries     int        `json:"max_retries" yaml:"max_retries"`
+	RateLimit      float64    `json:"rate_limit" yaml:"rate_limit"`
+	LogLevel       string     `json:"log_level" yaml:"log_level"`
+	LogFormat      string     `json:"log_format" yaml:"log_format"`
+
+	AdaptiveConcurrency bool     `json:"adaptive_concurrency" yaml:"adaptive_concurrency"`
+	MinConcurrency      int      `json:"min_concurrency" yaml:"min_concurrency"`
+	AutoStorage         bool     `json:"auto_storage" yaml:"auto_storage"`
+	CreateTimeout       duration `json:"create_timeout" yaml:"create_timeout"`
+	APITimeout          duration `json:"api_timeout" yaml:"api_timeout"`
+	StartTimeout        duration `json:"start_timeout" yaml:"start_timeout"`
+	GuestIPTimeout      duration `json:"guest_ip_timeout" yaml:"guest_ip_timeout"`
+	Timeout             duration `json:"timeout" yaml:"timeout"`
+	FailFast            bool     `json:"fail_fast" yaml:"fail_fast"`
+	DryRun              bool     `json:"dry_run" yaml:"dry_run"`
+	Force               bool     `json:"force" yaml:"force"`
+	StopOnError         bool     `json:"stop_on_error" yaml:"stop_on_error"`
+	SnapshotAfter       string   `json:"snapshot_after" yaml:"snapshot_after"`
+	SealToTemplate      bool     `json:"seal_to_template" yaml:"seal_to_template"`
+	PrintCloudInit      bool     `json:"print_cloud_init" yaml:"print_cloud_init"`
+	AffinityPositive    bool     `json:"affinity_positive" yaml:"affinity_positive"`
+	AffinityEnforcing   bool     `json:"affinity_enforcing" yaml:"affinity_enforcing"`
+	DetachOnly          bool     `json:"detach_only" yaml:"detach_only"`
+	NameFilter          string   `json:"name_filter" yaml:"name_filter"`
+	Offset              int      `json:"offset" yaml:"offset"`
+	Limit               int      `json:"limit" yaml:"limit"`
+	NoSummary           bool     `json:"no_summary" yaml:"no_summary"`
+	ReportFile          string   `json:"report" yaml:"report"`
+	OutputCSV           string   `json:"output_csv" yaml:"output_csv"`
+	MetricsFile         string   `json:"metrics_file" yaml:"metrics_file"`
+	Output              string   `json:"output" yaml:"output"`
+
+	// Further engines that rows can target through their Engine column
+	Engines map[string]EngineConfig `json:"engines" yaml:"engines"`
+}
+
+// stringList is a flag holding a comma-separated list, such as
+// --storage-domains sd1,sd2. In a config file it is a regular list.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// duration is a time.Duration that a config file gives as a string such as
+// "90s" or "2h", like its flag. Its flag is registered through a
+// *time.Duration conversion.
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// loadConfig reads a YAML or JSON config file into cfg. Keys missing from the
+// file leave the existing values in cfg untouched.
+func loadConfig(filename string, cfg *Config) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		err = json.Unmarshal(data, cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file format %q: use .json, .yaml or .yml", filepath.Ext(filename))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", filename, err)
+	}
+	return nil
+}
+
+// resolvePassword picks the engine password from, in order of precedence, the
+// --password flag, the first line of --password-file, or $OVIRT_PASSWORD.
+func resolvePassword(cfg Config) (string, error) {
+	if cfg.Password != "" {
+		return cfg.Password, nil
+	}
+	if cfg.PasswordFile != "" {
+		f, err := os.Open(cfg.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to open password file: %w", err)
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		scanner.Scan()
+		if err := scanner.Err(); err != nil {
+			return "", fmt.Errorf("failed to read password file: %w", err)
+		}
+		password := strings.TrimRight(scanner.Text(), "\r")
+		if password == "" {
+			return "", fmt.Errorf("password file %s is empty", cfg.PasswordFile)
+		}
+		return password, nil
+	}
+	if password := os.Getenv("OVIRT_PASSWORD"); password != "" {
+		return password, nil
+	}
+	return "", errors.New("no password set: use --password, --password-file or OVIRT_PASSWORD")
+}
@@ -0,0 +1,54 @@
+package ovirtvm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoadConfigRunSettings checks that run settings such as timeouts and
+// --dry-run load from both formats, and that keys missing from the file keep
+// the flag defaults already in cfg.
+func TestLoadConfigRunSettings(t *testing.T) {
+	files := map[string]string{
+		"ovirt.yaml": "dry_run: true\ncreate_timeout: 45m\ntimeout: 2h\nreport: report.json\nstop_on_error: true\n",
+		"ovirt.json": `{"dry_run": true, "create_timeout": "45m", "timeout": "2h", "report": "report.json", "stop_on_error": true}`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			cfg := Config{StartTimeout: duration(DefaultStartTimeout), Output: "plain"}
+			if err := loadConfig(filename, &cfg); err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if !cfg.DryRun || !cfg.StopOnError || cfg.ReportFile != "report.json" {
+				t.Errorf("dry run, stop on error, report = %t, %t, %q", cfg.DryRun, cfg.StopOnError, cfg.ReportFile)
+			}
+			if time.Duration(cfg.CreateTimeout) != 45*time.Minute || time.Duration(cfg.Timeout) != 2*time.Hour {
+				t.Errorf("create timeout, timeout = %s, %s", time.Duration(cfg.CreateTimeout), time.Duration(cfg.Timeout))
+			}
+			if time.Duration(cfg.StartTimeout) != DefaultStartTimeout || cfg.Output != "plain" {
+				t.Errorf("start timeout, output = %s, %q; want the defaults kept", time.Duration(cfg.StartTimeout), cfg.Output)
+			}
+		})
+	}
+}
+
+// TestLoadConfigRejectsBadDuration checks that a duration must be written
+// like its flag, with a unit.
+func TestLoadConfigRejectsBadDuration(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ovirt.yaml")
+	if err := os.WriteFile(filename, []byte("start_timeout: ten minutes\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var cfg Config
+	err := loadConfig(filename, &cfg)
+	if err == nil || !strings.Contains(err.Error(), "ten minutes") {
+		t.Fatalf("loadConfig error = %v, want the bad duration named", err)
+	}
+}
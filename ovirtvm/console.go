@@ -0,0 +1,70 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// consoleNone in the Console column removes every graphics console, leaving
+// the VM headless; the serial console is unaffected.
+const consoleNone = "none"
+
+// consoleTypes lists the values accepted in the Console column.
+var consoleTypes = []string{
+	string(ovirtsdk4.GRAPHICSTYPE_VNC),
+	string(ovirtsdk4.GRAPHICSTYPE_SPICE),
+	consoleNone,
+}
+
+// parseConsole checks a Console column value. An empty value keeps the
+// consoles the template has.
+func parseConsole(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	for _, console := range consoleTypes {
+		if strings.EqualFold(value, console) {
+			return console, nil
+		}
+	}
+	return "", fmt.Errorf("unknown console %q (valid: %s)", value, strings.Join(consoleTypes, ", "))
+}
+
+// configureConsole leaves the VM with exactly one graphics console of the
+// given protocol, or none for consoleNone. Consoles inherited from the
+// template with another protocol are removed, so a template offering both
+// VNC and SPICE doesn't keep the unwanted one. The VM must be down.
+func configureConsole(vmService *ovirtsdk4.VmService, console string) error {
+	consolesService := vmService.GraphicsConsolesService()
+	resp, err := consolesService.List().Send()
+	if err != nil {
+		return fmt.Errorf("failed to list graphics consoles: %w", err)
+	}
+	found := false
+	if consoles, ok := resp.Consoles(); ok {
+		for _, existing := range consoles.Slice() {
+			protocol, _ := existing.Protocol()
+			if string(protocol) == console && !found {
+				found = true
+				continue
+			}
+			id, _ := existing.Id()
+			if _, err := consolesService.ConsoleService(id).Remove().Send(); err != nil {
+				return fmt.Errorf("failed to remove %s console: %w", protocol, err)
+			}
+		}
+	}
+	if found || console == consoleNone {
+		return nil
+	}
+	graphics, err := ovirtsdk4.NewGraphicsConsoleBuilder().Protocol(ovirtsdk4.GraphicsType(console)).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build %s console: %w", console, err)
+	}
+	if _, err := consolesService.Add().Console(graphics).Send(); err != nil {
+		return fmt.Errorf("failed to add %s console: %w", console, err)
+	}
+	return nil
+}
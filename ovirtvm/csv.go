@@ -0,0 +1,720 @@
+package ovirtvm
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// csvColumns lists the CSV columns in their positional order. The first
+// requiredCSVColumns entries are mandatory; the rest may be omitted.
+var csvColumns = []string{
+	"Name",
+	"Template",
+	"Cluster",
+	"Class",
+	"Nic",
+	"IP",
+	"Gateway",
+	"Mask",
+	"DNS",
+	"DNS1",
+	"DNS2",
+	"CPU Cores",
+	"CPU Sockets",
+	"Memory",
+	"Memory Guaranteed",
+	"Size",
+	"StorageDomain",
+	"Network",
+	"Start",
+	"Disks",
+	"DiskInterface",
+	"NicInterface",
+	"DiskFormat",
+	"Sparse",
+	"BootProto",
+	"IPv6",
+	"IPv6Gateway",
+	"IPv6Prefix",
+	"Hostname",
+	"SSHKey",
+	"RootPassword",
+	"Description",
+	"Comment",
+	"Tags",
+	"ISO",
+	"Host",
+	"AffinityGroup",
+	"HA",
+	"HAPriority",
+	"MemoryMax",
+	"DiskName",
+	"CpuPinning",
+	"NumaNodes",
+	"CpuType",
+	"BootOrder",
+	"CPUThreads",
+	"CloudInitFile",
+	"OsType",
+	"OrgName",
+	"Domain",
+	"DomainOU",
+	"VmType",
+	"ProvisioningType",
+	"MigrationPolicy",
+	"InstanceType",
+	"CustomProperties",
+	"Quota",
+	"DataCenter",
+	"TemplateSearch",
+	"SearchDomains",
+	"Engine",
+	"Snapshot",
+	"TemplateName",
+	"TimeZone",
+	"SerialNumber",
+	"Console",
+	"DiskQoS",
+	"NetworkQoS",
+	"AttachDisks",
+	"WipeAfterDelete",
+	"Backup",
+}
+
+const requiredCSVColumns = 16
+
+// normalizeColumn makes header matching insensitive to case, spaces and
+// underscores, so "CPU Cores", "cpu_cores" and "CPUCores" are equivalent.
+func normalizeColumn(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.ReplaceAll(name, " ", "")
+	return strings.ReplaceAll(name, "_", "")
+}
+
+// headerColumns maps each normalized header name to its column index and
+// checks that every required column is present. Unknown columns are ignored.
+func headerColumns(record []string) (map[string]int, error) {
+	columns := make(map[string]int, len(record))
+	for i, name := range record {
+		columns[normalizeColumn(name)] = i
+	}
+	for _, name := range csvColumns[:requiredCSVColumns] {
+		if _, ok := columns[normalizeColumn(name)]; !ok {
+			return nil, fmt.Errorf("missing required CSV column %q", name)
+		}
+	}
+	return columns, nil
+}
+
+// positionalColumns maps the known columns to their fixed positions for CSV
+// files without a header row.
+func positionalColumns() map[string]int {
+	columns := make(map[string]int, len(csvColumns))
+	for i, name := range csvColumns {
+		columns[normalizeColumn(name)] = i
+	}
+	return columns
+}
+
+func parseCSV(filename string, header, failFast bool) ([]VMParams, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer f.Close()
+	return readCSV(f, header, failFast)
+}
+
+// readCSV parses the VM records read from in. With header set the first
+// record names the columns; otherwise they are read in csvColumns order.
+// failFast stops at the first invalid record.
+func readCSV(in io.Reader, header, failFast bool) ([]VMParams, error) {
+	r := csv.NewReader(in)
+	var vms []VMParams
+	line := 1 // Track line number for error reporting
+
+	// Problems are collected so a whole file can be fixed in one pass
+	var invalid []error
+	columns := positionalColumns()
+	if header {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		columns, err = headerColumns(record)
+		if err != nil {
+			return nil, err
+		}
+		line++
+	}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			invalid = append(invalid, fmt.Errorf("failed to read CSV record at line %d: %w", line, err))
+			if failFast {
+				return nil, invalid[0]
+			}
+			line++
+			continue
+		}
+
+		// Trailing optional columns may be left off in files without a header
+		if !header && (len(record) < requiredCSVColumns || len(record) > len(csvColumns)) {
+			invalid = append(invalid, fmt.Errorf("invalid number of fields in CSV record at line %d", line))
+			if failFast {
+				return nil, invalid[0]
+			}
+			line++
+			continue
+		}
+
+		field := func(name string) string {
+			i, ok := columns[normalizeColumn(name)]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return record[i]
+		}
+		vm, problems := parseRecord(field, line)
+		invalid = append(invalid, problems...)
+		if failFast && len(invalid) > 0 {
+			return nil, invalid[0]
+		}
+		vms = append(vms, vm)
+
+		line++
+	}
+
+	invalid = append(invalid, checkDiskNames(vms)...)
+	invalid = append(invalid, checkSharedDisks(vms)...)
+	if len(invalid) > 0 {
+		if failFast {
+			return nil, invalid[0]
+		}
+		return nil, errors.Join(invalid...)
+	}
+	return vms, nil
+}
+
+// parseRecord builds the VMParams for one input record. field returns the raw
+// value of the named column, or "" when it is absent. Parse errors leave the
+// field at its zero value so the rest of the record is still checked.
+func parseRecord(field func(name string) string, line int) (VMParams, []error) {
+	var invalid []error
+	reject := func(err error) {
+		invalid = append(invalid, err)
+	}
+
+	// With an instance type, the CPU and memory columns may be left empty to inherit its values
+	instanceType := field("InstanceType")
+	inherited := func(name string) bool {
+		return instanceType != "" && field(name) == ""
+	}
+
+	var err error
+	var cpuCores, cpuSockets int
+	if !inherited("CPU Cores") {
+		cpuCores, err = strconv.Atoi(field("CPU Cores"))
+		if err != nil {
+			reject(fmt.Errorf("failed to parse CPU cores at line %d: %w", line, err))
+		}
+	}
+
+	if !inherited("CPU Sockets") {
+		cpuSockets, err = strconv.Atoi(field("CPU Sockets"))
+		if err != nil {
+			reject(fmt.Errorf("failed to parse CPU sockets at line %d: %w", line, err))
+		}
+	}
+
+	var memory, memoryGuaranteed int64
+	if !inherited("Memory") {
+		memory, err = strconv.ParseInt(field("Memory"), 10, 64)
+		if err != nil {
+			reject(fmt.Errorf("failed to parse memory at line %d: %w", line, err))
+		}
+	}
+
+	if !inherited("Memory Guaranteed") {
+		memoryGuaranteed, err = strconv.ParseInt(field("Memory Guaranteed"), 10, 64)
+		if err != nil {
+			reject(fmt.Errorf("failed to parse guaranteed memory at line %d: %w", line, err))
+		}
+	}
+
+	var memoryMax int64
+	if value := field("MemoryMax"); value != "" {
+		memoryMax, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			reject(fmt.Errorf("failed to parse max memory at line %d: %w", line, err))
+		}
+	}
+
+	size, err := strconv.ParseInt(field("Size"), 10, 64)
+	if err != nil {
+		reject(fmt.Errorf("failed to parse disk size at line %d: %w", line, err))
+	}
+
+	var start *bool
+	if value := field("Start"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			reject(fmt.Errorf("failed to parse start at line %d: %w", line, err))
+		}
+		start = &parsed
+	}
+
+	var wipeAfterDelete *bool
+	if value := field("WipeAfterDelete"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			reject(fmt.Errorf("failed to parse wipe after delete at line %d: %w", line, err))
+		}
+		wipeAfterDelete = &parsed
+	}
+
+	var backup *bool
+	if value := field("Backup"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			reject(fmt.Errorf("failed to parse backup at line %d: %w", line, err))
+		}
+		backup = &parsed
+	}
+
+	diskInterface, err := parseDiskInterface(field("DiskInterface"))
+	if err != nil {
+		reject(fmt.Errorf("failed to parse disk interface at line %d: %w", line, err))
+	}
+
+	nicInterface, err := parseNicInterface(field("NicInterface"))
+	if err != nil {
+		reject(fmt.Errorf("failed to parse nic interface at line %d: %w", line, err))
+	}
+
+	diskFormat, err := parseDiskFormat(field("DiskFormat"))
+	if err != nil {
+		reject(fmt.Errorf("failed to parse disk format at line %d: %w", line, err))
+	}
+
+	sparse := true
+	if value := field("Sparse"); value != "" {
+		sparse, err = strconv.ParseBool(value)
+		if err != nil {
+			reject(fmt.Errorf("failed to parse sparse at line %d: %w", line, err))
+		}
+	}
+
+	disks, err := parseDisks(field("Disks"), diskSpec{Interface: diskInterface, Format: diskFormat, Sparse: sparse})
+	if err != nil {
+		reject(fmt.Errorf("failed to parse disks at line %d: %w", line, err))
+	}
+
+	attachDisks, err := parseAttachDisks(field("AttachDisks"), diskInterface)
+	if err != nil {
+		reject(fmt.Errorf("failed to parse attached disks at line %d: %w", line, err))
+	}
+
+	bootProto, err := parseBootProto(field("BootProto"), field("IP"), field("IPv6"))
+	if err != nil {
+		reject(fmt.Errorf("failed to parse boot protocol at line %d: %w", line, err))
+	}
+	// IPv4 addressing may only be omitted on static rows that are IPv6-only
+	if bootProto == bootProtoStatic && (field("IP") != "" || field("IPv6") == "") {
+		for _, name := range []string{"IP", "Mask", "Gateway"} {
+			if field(name) == "" {
+				reject(fmt.Errorf("missing %s for static addressing at line %d", name, line))
+			}
+		}
+	}
+
+	ipv6Prefix := 64
+	if value := field("IPv6Prefix"); value != "" {
+		ipv6Prefix, err = strconv.Atoi(value)
+		if err != nil || ipv6Prefix < 1 || ipv6Prefix > 128 {
+			reject(fmt.Errorf("invalid IPv6 prefix %q at line %d", value, line))
+		}
+	}
+
+	hostname := field("Hostname")
+	if hostname == "" {
+		hostname = field("Name")
+	}
+
+	var ha bool
+	if value := field("HA"); value != "" {
+		ha, err = strconv.ParseBool(value)
+		if err != nil {
+			reject(fmt.Errorf("failed to parse HA at line %d: %w", line, err))
+		}
+	}
+
+	var haPriority int64
+	if value := field("HAPriority"); value != "" {
+		haPriority, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			reject(fmt.Errorf("failed to parse HA priority at line %d: %w", line, err))
+		}
+	}
+
+	cpuPinning, err := parseCPUPinning(field("CpuPinning"))
+	if err != nil {
+		reject(fmt.Errorf("failed to parse CPU pinning at line %d: %w", line, err))
+	}
+
+	var numaNodes int
+	if value := field("NumaNodes"); value != "" {
+		numaNodes, err = strconv.Atoi(value)
+		if err != nil {
+			reject(fmt.Errorf("failed to parse NUMA nodes at line %d: %w", line, err))
+		}
+	}
+
+	cpuThreads := 1
+	if value := field("CPUThreads"); value != "" {
+		cpuThreads, err = strconv.Atoi(value)
+		if err != nil {
+			reject(fmt.Errorf("failed to parse CPU threads at line %d: %w", line, err))
+		}
+	}
+
+	var userData string
+	if file := field("CloudInitFile"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			reject(fmt.Errorf("failed to read cloud-init file at line %d: %w", line, err))
+		} else if _, err := userDataMapping(string(data)); err != nil {
+			reject(fmt.Errorf("failed to parse cloud-init file %s at line %d: %w", file, line, err))
+		}
+		userData = string(data)
+	}
+
+	bootOrder, err := parseBootOrder(field("BootOrder"))
+	if err != nil {
+		reject(fmt.Errorf("failed to parse boot order at line %d: %w", line, err))
+	}
+
+	vmType, err := parseVMType(field("VmType"))
+	if err != nil {
+		reject(fmt.Errorf("failed to parse VM type at line %d: %w", line, err))
+	}
+
+	provisioning, err := parseProvisioningType(field("ProvisioningType"))
+	if err != nil {
+		reject(fmt.Errorf("failed to parse provisioning type at line %d: %w", line, err))
+	}
+
+	migrationPolicy, err := parseMigrationPolicy(field("MigrationPolicy"), field("Host"))
+	if err != nil {
+		reject(fmt.Errorf("failed to parse migration policy at line %d: %w", line, err))
+	}
+
+	customProperties, err := parseCustomProperties(field("CustomProperties"))
+	if err != nil {
+		reject(fmt.Errorf("failed to parse custom properties at line %d: %w", line, err))
+	}
+
+	serialPolicy, serialNumber := parseSerialNumber(field("SerialNumber"))
+
+	console, err := parseConsole(field("Console"))
+	if err != nil {
+		reject(fmt.Errorf("failed to parse console at line %d: %w", line, err))
+	}
+
+	nic := field("Nic")
+	if nic == "" {
+		nic = defaultGuestNic
+	}
+
+	vm := VMParams{
+		Name:             field("Name"),
+		Template:         field("Template"),
+		Cluster:          field("Cluster"),
+		Class:            field("Class"),
+		Nic:              nic,
+		IP:               field("IP"),
+		Gateway:          field("Gateway"),
+		Mask:             field("Mask"),
+		DNS:              splitList(strings.Join([]string{field("DNS"), field("DNS1"), field("DNS2")}, ";")),
+		CPUCores:         cpuCores,
+		CPUSockets:       cpuSockets,
+		CPUThreads:       cpuThreads,
+		Memory:           memory,
+		MemoryGuaranteed: memoryGuaranteed,
+		Size:             size,
+		StorageDomain:    field("StorageDomain"),
+		Network:          field("Network"),
+		Start:            start,
+		Disks:            disks,
+		DiskInterface:    diskInterface,
+		NicInterface:     nicInterface,
+		DiskFormat:       diskFormat,
+		Sparse:           sparse,
+		BootProto:        bootProto,
+		IPv6:             field("IPv6"),
+		IPv6Gateway:      field("IPv6Gateway"),
+		IPv6Prefix:       ipv6Prefix,
+		Hostname:         hostname,
+		SSHKeys:          splitList(field("SSHKey")),
+		RootPassword:     secret(field("RootPassword")),
+		Description:      field("Description"),
+		Comment:          field("Comment"),
+		Tags:             splitList(field("Tags")),
+		ISO:              field("ISO"),
+		Host:             field("Host"),
+		AffinityGroup:    field("AffinityGroup"),
+		HA:               ha,
+		HAPriority:       haPriority,
+		MemoryMax:        memoryMax,
+		DiskName:         field("DiskName"),
+		CPUPinning:       cpuPinning,
+		NumaNodes:        numaNodes,
+		CPUType:          field("CpuType"),
+		BootOrder:        bootOrder,
+		UserData:         userData,
+		OSType:           field("OsType"),
+		OrgName:          field("OrgName"),
+		Domain:           field("Domain"),
+		DomainOU:         field("DomainOU"),
+		VMType:           vmType,
+		Provisioning:     provisioning,
+		MigrationPolicy:  migrationPolicy,
+		InstanceType:     instanceType,
+		CustomProperties: customProperties,
+		Quota:            field("Quota"),
+		DataCenter:       field("DataCenter"),
+		TemplateSearch:   field("TemplateSearch"),
+		SearchDomains:    splitList(field("SearchDomains")),
+		Engine:           field("Engine"),
+		Snapshot:         field("Snapshot"),
+		TemplateName:     field("TemplateName"),
+		TimeZone:         field("TimeZone"),
+		SerialPolicy:     serialPolicy,
+		SerialNumber:     serialNumber,
+		Console:          console,
+		DiskQoS:          field("DiskQoS"),
+		NetworkQoS:       field("NetworkQoS"),
+		AttachDisks:      attachDisks,
+		WipeAfterDelete:  wipeAfterDelete,
+		Backup:           backup,
+		line:             line,
+		record:           make([]string, len(csvColumns)),
+	}
+	// Range checks on a record that failed to parse would only repeat its errors
+	if len(invalid) == 0 {
+		problems := validateVMParams(vm)
+		problems = append(problems, normalizeAddresses(&vm)...)
+		for _, problem := range problems {
+			reject(fmt.Errorf("invalid record at line %d: %s", line, problem))
+		}
+	}
+	for i, name := range csvColumns {
+		vm.record[i] = field(name)
+	}
+	return vm, invalid
+}
+
+// checkDiskNames reports disk names produced by more than one record. Disks
+// are looked up by name, so two rows must never produce the same one.
+func checkDiskNames(vms []VMParams) []error {
+	var invalid []error
+	diskLines := make(map[string]int)
+	for _, vm := range vms {
+		count := len(vm.Disks)
+		if count == 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			name := vm.diskName(i)
+			if first, ok := diskLines[name]; ok {
+				invalid = append(invalid, fmt.Errorf("invalid record at line %d: disk name %q is already used at line %d", vm.line, name, first))
+				continue
+			}
+			diskLines[name] = vm.line
+		}
+	}
+	return invalid
+}
+
+// normalizeAddresses validates the row's IP addressing fields and rewrites
+// Mask to dotted-decimal form, so "24", "/24" and "255.255.255.0" are all
+// accepted. Empty fields are left alone; required ones are checked elsewhere.
+func normalizeAddresses(vm *VMParams) []string {
+	var problems []string
+	checkIPv4 := func(name, value string) {
+		if value == "" {
+			return
+		}
+		if ip := net.ParseIP(value); ip == nil || ip.To4() == nil {
+			problems = append(problems, fmt.Sprintf("invalid %s %q: not an IPv4 address", name, value))
+		}
+	}
+	checkIP := func(name, value string) {
+		if value != "" && net.ParseIP(value) == nil {
+			problems = append(problems, fmt.Sprintf("invalid %s %q: not an IP address", name, value))
+		}
+	}
+
+	checkIPv4("IP", vm.IP)
+	checkIPv4("Gateway", vm.Gateway)
+	for _, server := range vm.DNS {
+		checkIP("DNS", server)
+	}
+	if vm.IPv6 != "" {
+		if ip := net.ParseIP(vm.IPv6); ip == nil || ip.To4() != nil {
+			problems = append(problems, fmt.Sprintf("invalid IPv6 %q: not an IPv6 address", vm.IPv6))
+		}
+	}
+	checkIP("IPv6Gateway", vm.IPv6Gateway)
+
+	if vm.Mask != "" {
+		mask, err := normalizeMask(vm.Mask)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid Mask %q: %v", vm.Mask, err))
+		} else {
+			vm.Mask = mask
+		}
+	}
+	return problems
+}
+
+// normalizeMask converts a dotted-decimal netmask or a CIDR prefix length
+// (with or without a leading slash) to dotted-decimal form.
+func normalizeMask(value string) (string, error) {
+	prefix := strings.TrimPrefix(value, "/")
+	if bits, err := strconv.Atoi(prefix); err == nil {
+		if bits < 0 || bits > 32 {
+			return "", fmt.Errorf("prefix length must be between 0 and 32")
+		}
+		return net.IP(net.CIDRMask(bits, 32)).String(), nil
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil || ip.To4() == nil {
+		return "", fmt.Errorf("not a netmask or prefix length")
+	}
+	if ones, bits := net.IPMask(ip.To4()).Size(); ones == 0 && bits == 0 {
+		return "", fmt.Errorf("netmask bits are not contiguous")
+	}
+	return ip.To4().String(), nil
+}
+
+// validateVMParams checks a parsed row for values the engine would reject
+// and returns a description of each problem found.
+func validateVMParams(vm VMParams) []string {
+	var problems []string
+	// Values inherited from an instance type are only known once it is resolved
+	inheritCPU := vm.InstanceType != "" && vm.CPUCores == 0 && vm.CPUSockets == 0
+	inheritMemory := vm.InstanceType != "" && vm.Memory == 0
+	if !inheritCPU && vm.CPUCores <= 0 {
+		problems = append(problems, fmt.Sprintf("CPU cores must be positive, got %d", vm.CPUCores))
+	}
+	if !inheritCPU && vm.CPUSockets <= 0 {
+		problems = append(problems, fmt.Sprintf("CPU sockets must be positive, got %d", vm.CPUSockets))
+	}
+	if vm.CPUThreads < 1 {
+		problems = append(problems, fmt.Sprintf("CPU threads must be at least 1, got %d", vm.CPUThreads))
+	}
+	if !inheritMemory && vm.MemoryGuaranteed > vm.Memory {
+		problems = append(problems, fmt.Sprintf("guaranteed memory %d exceeds memory %d", vm.MemoryGuaranteed, vm.Memory))
+	}
+	if vm.MemoryMax != 0 && vm.Memory > vm.MemoryMax {
+		problems = append(problems, fmt.Sprintf("memory %d exceeds max memory %d", vm.Memory, vm.MemoryMax))
+	}
+	if len(vm.Disks) == 0 && vm.Size <= 0 {
+		problems = append(problems, fmt.Sprintf("disk size must be positive, got %d", vm.Size))
+	}
+	for i, disk := range vm.Disks {
+		if disk.Size <= 0 {
+			problems = append(problems, fmt.Sprintf("disk %d size must be positive, got %d", i+1, disk.Size))
+		}
+	}
+	vcpus := vm.vcpus()
+	if len(vm.CPUPinning) > 0 && vm.Host == "" {
+		problems = append(problems, "CPU pinning requires the Host column")
+	}
+	if len(vm.CPUPinning) > 0 && vm.MigrationPolicy == ovirtsdk4.VMAFFINITY_MIGRATABLE {
+		problems = append(problems, "CPU pinning requires the user_migratable or pinned migration policy")
+	}
+	if vm.MigrationPolicy == ovirtsdk4.VMAFFINITY_PINNED && vm.Host == "" {
+		problems = append(problems, "the pinned migration policy requires the Host column")
+	}
+	for _, pin := range vm.CPUPinning {
+		if !inheritCPU && pin.VCPU >= vcpus {
+			problems = append(problems, fmt.Sprintf("vcpu %d is pinned but the VM only has %d vCPUs", pin.VCPU, vcpus))
+		}
+	}
+	if vm.NumaNodes < 0 || (!inheritCPU && vm.NumaNodes > vcpus) {
+		problems = append(problems, fmt.Sprintf("NUMA nodes must be between 0 and the %d vCPUs, got %d", vcpus, vm.NumaNodes))
+	}
+	if problem := guestNicProblem(vm.Nic); problem != "" {
+		problems = append(problems, problem)
+	}
+	for _, domain := range vm.SearchDomains {
+		if !searchDomainPattern.MatchString(domain) {
+			problems = append(problems, fmt.Sprintf("invalid search domain %q", domain))
+		}
+	}
+	if vm.TemplateSearch != "" && vm.Template != "" {
+		problems = append(problems, "Template and TemplateSearch are mutually exclusive")
+	}
+	if vm.TemplateSearch != "" && strings.TrimSpace(vm.TemplateSearch) == "" {
+		problems = append(problems, "TemplateSearch must not be blank")
+	}
+	if problem := timeZoneProblem(vm.TimeZone, isWindows(vm.OSType)); problem != "" {
+		problems = append(problems, problem)
+	}
+	if vm.Provisioning == provisioningThin {
+		problems = append(problems, thinProblems(vm)...)
+	}
+	if vm.Backup != nil && *vm.Backup {
+		problems = append(problems, backupProblems(vm)...)
+	}
+	if isWindows(vm.OSType) {
+		problems = append(problems, windowsProblems(vm)...)
+	} else if vm.OrgName != "" || vm.Domain != "" || vm.DomainOU != "" {
+		problems = append(problems, "OrgName, Domain and DomainOU are only supported on Windows guests")
+	}
+	return problems
+}
+
+// splitList splits a semicolon-separated CSV value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// readSSHKeys reads one public key per non-empty line, skipping comments.
+func readSSHKeys(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key file: %w", err)
+	}
+	var keys []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			keys = append(keys, line)
+		}
+	}
+	return keys, nil
+}
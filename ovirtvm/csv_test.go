@@ -0,0 +1,230 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testCSVHeader names the required CSV columns in their positional order.
+const testCSVHeader = "Name,Template,Cluster,Class,Nic,IP,Gateway,Mask,DNS,DNS1,DNS2,CPU Cores,CPU Sockets,Memory,Memory Guaranteed,Size\n"
+
+// TestParseCSV checks the fields parsed from a static and a DHCP row, with
+// and without a header.
+func TestParseCSV(t *testing.T) {
+	rows := "web1,rhel9,prod,server,ens3,192.0.2.10,192.0.2.1,24,192.0.2.53;192.0.2.54,,192.0.2.55,2,1,4294967296,2147483648,21474836480\n" +
+		"db1,rhel9,prod,server,,,,,,,,4,2,8589934592,8589934592,53687091200\n"
+	for _, header := range []bool{true, false} {
+		t.Run(fmt.Sprintf("header=%t", header), func(t *testing.T) {
+			input := rows
+			if header {
+				input = testCSVHeader + rows
+			}
+			vms, err := ParseCSV(strings.NewReader(input), header)
+			if err != nil {
+				t.Fatalf("ParseCSV: %v", err)
+			}
+			if len(vms) != 2 {
+				t.Fatalf("got %d VMs, want 2", len(vms))
+			}
+
+			web, db := vms[0], vms[1]
+			line := 1
+			if header {
+				line = 2
+			}
+			if web.Name != "web1" || web.Template != "rhel9" || web.Cluster != "prod" || web.line != line {
+				t.Errorf("web1: name, template, cluster, line = %q, %q, %q, %d", web.Name, web.Template, web.Cluster, web.line)
+			}
+			if web.BootProto != bootProtoStatic || web.Nic != "ens3" || web.IP != "192.0.2.10" || web.Gateway != "192.0.2.1" {
+				t.Errorf("web1: boot proto, nic, IP, gateway = %q, %q, %q, %q", web.BootProto, web.Nic, web.IP, web.Gateway)
+			}
+			if web.Mask != "255.255.255.0" {
+				t.Errorf("web1: mask = %q, want the prefix length converted to 255.255.255.0", web.Mask)
+			}
+			if want := []string{"192.0.2.53", "192.0.2.54", "192.0.2.55"}; !reflect.DeepEqual(web.DNS, want) {
+				t.Errorf("web1: DNS = %q, want %q", web.DNS, want)
+			}
+			if web.CPUCores != 2 || web.CPUSockets != 1 || web.CPUThreads != 1 || web.vcpus() != 2 {
+				t.Errorf("web1: cores, sockets, threads = %d, %d, %d", web.CPUCores, web.CPUSockets, web.CPUThreads)
+			}
+			if web.Memory != 4294967296 || web.MemoryGuaranteed != 2147483648 || web.Size != 21474836480 {
+				t.Errorf("web1: memory, guaranteed, size = %d, %d, %d", web.Memory, web.MemoryGuaranteed, web.Size)
+			}
+			if web.Hostname != "web1" || web.Start != nil || !web.Sparse {
+				t.Errorf("web1: hostname, start, sparse = %q, %v, %t; want the defaults", web.Hostname, web.Start, web.Sparse)
+			}
+
+			if db.BootProto != bootProtoDHCP || db.Nic != defaultGuestNic || len(db.DNS) != 0 {
+				t.Errorf("db1: boot proto, nic, DNS = %q, %q, %q; want DHCP on %s", db.BootProto, db.Nic, db.DNS, defaultGuestNic)
+			}
+			if db.vcpus() != 8 || db.line != line+1 {
+				t.Errorf("db1: vcpus, line = %d, %d", db.vcpus(), db.line)
+			}
+		})
+	}
+}
+
+// TestParseCSVErrors checks that invalid input is rejected with the line and
+// problem, and that every invalid record of a file is reported.
+func TestParseCSVErrors(t *testing.T) {
+	const valid = "web1,rhel9,prod,server,eth0,192.0.2.10,192.0.2.1,24,192.0.2.53,,,2,1,4096,2048,10\n"
+	tests := []struct {
+		name  string
+		input string
+		want  []string // Substrings the error must contain
+	}{
+		{
+			name:  "missing column",
+			input: "Name,Template,Cluster\nweb1,rhel9,prod\n",
+			want:  []string{`missing required CSV column "Class"`},
+		},
+		{
+			name:  "bad number",
+			input: testCSVHeader + "web1,rhel9,prod,server,eth0,192.0.2.10,192.0.2.1,24,,,,two,1,4096,2048,10\n",
+			want:  []string{"failed to parse CPU cores at line 2"},
+		},
+		{
+			name:  "guaranteed memory above memory",
+			input: testCSVHeader + "web1,rhel9,prod,server,eth0,192.0.2.10,192.0.2.1,24,,,,2,1,2048,4096,10\n",
+			want:  []string{"invalid record at line 2: guaranteed memory 4096 exceeds memory 2048"},
+		},
+		{
+			name:  "static row without gateway",
+			input: testCSVHeader + "web1,rhel9,prod,server,eth0,192.0.2.10,,24,,,,2,1,4096,2048,10\n",
+			want:  []string{"missing Gateway for static addressing at line 2"},
+		},
+		{
+			name:  "invalid addresses",
+			input: testCSVHeader + "web1,rhel9,prod,server,eth0,192.0.2.300,192.0.2.1,33,dns.example.com,,,2,1,4096,2048,10\n",
+			want: []string{
+				`invalid IP "192.0.2.300": not an IPv4 address`,
+				`invalid Mask "33": prefix length must be between 0 and 32`,
+				`invalid DNS "dns.example.com": not an IP address`,
+			},
+		},
+		{
+			name:  "duplicate names",
+			input: testCSVHeader + valid + valid,
+			want:  []string{`invalid record at line 3: disk name "web1_disk0" is already used at line 2`},
+		},
+		{
+			name:  "every invalid record is reported",
+			input: testCSVHeader + valid + "web2,rhel9,prod,server,eth0,,,,,,,0,1,4096,2048,10\n" + "web3,rhel9,prod,server,eth0,,,,,,,2,1,4096,2048,-1\n",
+			want: []string{
+				"invalid record at line 3: CPU cores must be positive, got 0",
+				"invalid record at line 4: disk size must be positive, got -1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vms, err := ParseCSV(strings.NewReader(tt.input), true)
+			if err == nil {
+				t.Fatalf("ParseCSV returned %d VMs and no error", len(vms))
+			}
+			if vms != nil {
+				t.Errorf("ParseCSV returned %d VMs along with its error", len(vms))
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+// TestValidateVMParams checks the problems reported for rows the engine
+// would reject, starting from a row that has none.
+func TestValidateVMParams(t *testing.T) {
+	valid := func() VMParams {
+		return VMParams{
+			Name:             "web1",
+			Nic:              "eth0",
+			CPUCores:         2,
+			CPUSockets:       1,
+			CPUThreads:       1,
+			Memory:           4096,
+			MemoryGuaranteed: 2048,
+			Size:             10,
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(vm *VMParams)
+		want   []string // Exactly the expected problems, in order
+	}{
+		{
+			name:   "valid",
+			modify: func(vm *VMParams) {},
+		},
+		{
+			name:   "instance type supplies CPU and memory",
+			modify: func(vm *VMParams) { vm.InstanceType = "Large"; vm.CPUCores, vm.CPUSockets, vm.Memory = 0, 0, 0 },
+		},
+		{
+			name:   "no CPUs",
+			modify: func(vm *VMParams) { vm.CPUCores, vm.CPUSockets, vm.CPUThreads = 0, -1, 0 },
+			want: []string{
+				"CPU cores must be positive, got 0",
+				"CPU sockets must be positive, got -1",
+				"CPU threads must be at least 1, got 0",
+			},
+		},
+		{
+			name:   "memory limits",
+			modify: func(vm *VMParams) { vm.MemoryGuaranteed, vm.MemoryMax = 8192, 2048 },
+			want: []string{
+				"guaranteed memory 8192 exceeds memory 4096",
+				"memory 4096 exceeds max memory 2048",
+			},
+		},
+		{
+			name:   "disk sizes",
+			modify: func(vm *VMParams) { vm.Disks = []diskSpec{{Size: 10}, {Size: 0}} },
+			want:   []string{"disk 2 size must be positive, got 0"},
+		},
+		{
+			name:   "CPU pinning",
+			modify: func(vm *VMParams) { vm.CPUPinning = []vcpuPin{{VCPU: 0, CPUSet: "1"}, {VCPU: 2, CPUSet: "3"}} },
+			want: []string{
+				"CPU pinning requires the Host column",
+				"vcpu 2 is pinned but the VM only has 2 vCPUs",
+			},
+		},
+		{
+			name:   "NUMA nodes above vCPUs",
+			modify: func(vm *VMParams) { vm.NumaNodes = 3 },
+			want:   []string{"NUMA nodes must be between 0 and the 2 vCPUs, got 3"},
+		},
+		{
+			name:   "guest nic and search domains",
+			modify: func(vm *VMParams) { vm.Nic = "eth0:1"; vm.SearchDomains = []string{"example.com", "bad_domain"} },
+			want: []string{
+				`invalid Nic "eth0:1": must not contain slashes, colons or whitespace`,
+				`invalid search domain "bad_domain"`,
+			},
+		},
+		{
+			name:   "template and template search",
+			modify: func(vm *VMParams) { vm.Template, vm.TemplateSearch = "rhel9", "tag=stable" },
+			want:   []string{"Template and TemplateSearch are mutually exclusive"},
+		},
+		{
+			name:   "Windows settings on Linux",
+			modify: func(vm *VMParams) { vm.Domain = "corp.example.com" },
+			want:   []string{"OrgName, Domain and DomainOU are only supported on Windows guests"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := valid()
+			tt.modify(&vm)
+			if got := validateVMParams(vm); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateVMParams = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
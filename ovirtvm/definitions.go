@@ -0,0 +1,148 @@
+package ovirtvm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// listColumns holds the columns that take a YAML or JSON list. A list is
+// joined with ";", the separator splitList expects, into the single value
+// its CSV column holds.
+var listColumns = map[string]bool{
+	normalizeColumn("DNS"):              true,
+	normalizeColumn("Disks"):            true,
+	normalizeColumn("SSHKey"):           true,
+	normalizeColumn("Tags"):             true,
+	normalizeColumn("CpuPinning"):       true,
+	normalizeColumn("BootOrder"):        true,
+	normalizeColumn("CustomProperties"): true,
+	normalizeColumn("SearchDomains"):    true,
+	normalizeColumn("AttachDisks"):      true,
+}
+
+// parseDefinitions reads VM definitions from a YAML or JSON file (JSON is
+// parsed as YAML). The file holds a list of objects keyed by CSV column name,
+// matched the same way as a CSV header. Each object is parsed exactly like a
+// CSV record, and errors refer to the line in the file where the object starts.
+func parseDefinitions(filename string, failFast bool) ([]VMParams, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VM definitions: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse VM definitions %s: %w", filename, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	list := doc.Content[0]
+	if list.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("failed to parse VM definitions %s: top level must be a list of VMs", filename)
+	}
+
+	var vms []VMParams
+	var invalid []error
+	for _, node := range list.Content {
+		values, err := definitionRecord(node)
+		if err != nil {
+			invalid = append(invalid, fmt.Errorf("invalid record at line %d: %w", node.Line, err))
+			if failFast {
+				return nil, invalid[0]
+			}
+			continue
+		}
+		vm, problems := parseRecord(func(name string) string { return values[normalizeColumn(name)] }, node.Line)
+		invalid = append(invalid, problems...)
+		if failFast && len(invalid) > 0 {
+			return nil, invalid[0]
+		}
+		vms = append(vms, vm)
+	}
+
+	invalid = append(invalid, checkDiskNames(vms)...)
+	invalid = append(invalid, checkSharedDisks(vms)...)
+	if len(invalid) > 0 {
+		if failFast {
+			return nil, invalid[0]
+		}
+		return nil, errors.Join(invalid...)
+	}
+	return vms, nil
+}
+
+// definitionRecord flattens one VM definition into column values keyed by
+// normalized column name.
+func definitionRecord(node *yaml.Node) (map[string]string, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("VM definition must be an object")
+	}
+	known := positionalColumns()
+	values := make(map[string]string, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		column := normalizeColumn(key)
+		if _, ok := known[column]; !ok {
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+		if _, ok := values[column]; ok {
+			return nil, fmt.Errorf("field %q is set more than once", key)
+		}
+
+		switch value.Kind {
+		case yaml.ScalarNode:
+			if value.Tag != "!!null" {
+				values[column] = value.Value
+			}
+		case yaml.SequenceNode:
+			if !listColumns[column] {
+				return nil, fmt.Errorf("field %q does not take a list", key)
+			}
+			var items []string
+			for _, item := range value.Content {
+				text, err := listItem(column, item)
+				if err != nil {
+					return nil, fmt.Errorf("field %q: %w", key, err)
+				}
+				items = append(items, text)
+			}
+			values[column] = strings.Join(items, ";")
+		default:
+			return nil, fmt.Errorf("field %q must be a value or a list", key)
+		}
+	}
+	return values, nil
+}
+
+// listItem converts one list entry to its CSV form. Disks may also be given
+// as objects with size, interface and storage_domain keys.
+func listItem(column string, item *yaml.Node) (string, error) {
+	if item.Kind == yaml.ScalarNode {
+		return item.Value, nil
+	}
+	if item.Kind != yaml.MappingNode || column != normalizeColumn("Disks") {
+		return "", fmt.Errorf("list entries at line %d must be values", item.Line)
+	}
+
+	parts := make(map[string]string)
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		key, value := item.Content[i].Value, item.Content[i+1]
+		switch normalizeColumn(key) {
+		case "size", "interface", "storagedomain":
+		default:
+			return "", fmt.Errorf("unknown disk field %q at line %d", key, item.Content[i].Line)
+		}
+		if value.Kind != yaml.ScalarNode {
+			return "", fmt.Errorf("disk field %q at line %d must be a value", key, value.Line)
+		}
+		parts[normalizeColumn(key)] = value.Value
+	}
+	if parts["size"] == "" {
+		return "", fmt.Errorf("disk at line %d has no size", item.Line)
+	}
+	return strings.Join([]string{parts["size"], parts["interface"], parts["storagedomain"]}, ":"), nil
+}
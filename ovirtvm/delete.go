@@ -0,0 +1,80 @@
+package ovirtvm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// deleteVM stops and removes the VM named by the CSV row. Rows whose VM does
+// not exist are reported as warnings rather than failures.
+func deleteVM(ctx context.Context, vmParams VMParams, conn *ovirtsdk4.Connection, opts createOptions, errs *errorLog) vmResult {
+	logger := slog.With("vm", vmParams.Name, "line", vmParams.line)
+	result := vmResult{Name: vmParams.Name, Line: vmParams.line}
+	fail := func(err error) vmResult {
+		err = vmParams.withLine(err)
+		errs.add(err)
+		result.Status = statusFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	if ctx.Err() != nil {
+		return cancelledResult(vmParams)
+	}
+
+	vmsService := conn.SystemService().VmsService()
+	resp, err := vmsService.List().Search("name=" + vmParams.Name).Send()
+	if err != nil {
+		return fail(fmt.Errorf("failed to look up VM %s: %w", vmParams.Name, err))
+	}
+	var existing []*ovirtsdk4.Vm
+	if vms, ok := resp.Vms(); ok {
+		existing = vms.Slice()
+	}
+	if len(existing) == 0 {
+		logger.Warn("VM does not exist, nothing to delete", "event", "vm_missing")
+		result.Status = statusMissing
+		result.Warnings = append(result.Warnings, "VM does not exist")
+		return result
+	}
+
+	vm := existing[0]
+	vmID, ok := vm.Id()
+	if !ok {
+		return fail(fmt.Errorf("VM %s has no ID", vmParams.Name))
+	}
+	result.ID = vmID
+
+	if opts.DryRun {
+		logger.Info("[dry-run] would delete VM", "event", "dry_run", "id", vmID)
+		result.Status = statusValidated
+		return result
+	}
+
+	vmService := vmsService.VmService(vmID)
+	if status, _ := vm.Status(); status != ovirtsdk4.VMSTATUS_DOWN {
+		if _, err := vmService.Stop().Send(); err != nil {
+			return fail(fmt.Errorf("failed to stop VM %s: %w", vmParams.Name, err))
+		}
+		// Powering off takes about as long as powering on, so share the start timeout
+		if _, err := waitForVMStatus(ctx, vmService, ovirtsdk4.VMSTATUS_DOWN, opts.StartTimeout); err != nil {
+			return fail(fmt.Errorf("VM %s did not stop: %w", vmParams.Name, err))
+		}
+		logger.Info("VM stopped", "event", "vm_stopped")
+	}
+
+	if _, err := vmService.Remove().DetachOnly(opts.DetachOnly).Send(); err != nil {
+		return fail(fmt.Errorf("failed to remove VM %s: %w", vmParams.Name, err))
+	}
+
+	if opts.DetachOnly {
+		logger.Info("VM removed, disks kept", "event", "vm_removed", "disks_kept", true)
+	} else {
+		logger.Info("VM removed", "event", "vm_removed")
+	}
+	result.Status = statusDeleted
+	return result
+}
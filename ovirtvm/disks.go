@@ -0,0 +1,356 @@
+package ovirtvm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// diskSpec describes one disk requested through the Disks column.
+type diskSpec struct {
+	Size          int64
+	Interface     ovirtsdk4.DiskInterface
+	StorageDomain string // Falls back to the VM's storage domain when empty
+	Format        ovirtsdk4.DiskFormat
+	Sparse        bool
+	QuotaID       string // Set from the VM's Quota when it is created, not parsed
+	DiskProfileID string // Set from the VM's DiskQoS when it is created, not parsed
+
+	// Set from the VM's columns when it is created, not parsed; nil keeps the engine default
+	WipeAfterDelete *bool
+	Backup          *bool
+}
+
+// diskInterfaces lists the disk interfaces accepted in the CSV.
+var diskInterfaces = []ovirtsdk4.DiskInterface{
+	ovirtsdk4.DISKINTERFACE_IDE,
+	ovirtsdk4.DISKINTERFACE_SATA,
+	ovirtsdk4.DISKINTERFACE_SPAPR_VSCSI,
+	ovirtsdk4.DISKINTERFACE_VIRTIO,
+	ovirtsdk4.DISKINTERFACE_VIRTIO_SCSI,
+}
+
+// parseDiskInterface maps a CSV value to an SDK disk interface, defaulting
+// to virtio when the value is empty.
+func parseDiskInterface(value string) (ovirtsdk4.DiskInterface, error) {
+	if value == "" {
+		return ovirtsdk4.DISKINTERFACE_VIRTIO, nil
+	}
+	valid := make([]string, 0, len(diskInterfaces))
+	for _, iface := range diskInterfaces {
+		if strings.EqualFold(value, string(iface)) {
+			return iface, nil
+		}
+		valid = append(valid, string(iface))
+	}
+	return "", fmt.Errorf("unknown disk interface %q (valid: %s)", value, strings.Join(valid, ", "))
+}
+
+// parseDiskFormat maps "cow" or "raw" to the SDK disk format, defaulting to
+// cow when the value is empty.
+func parseDiskFormat(value string) (ovirtsdk4.DiskFormat, error) {
+	switch strings.ToLower(value) {
+	case "", string(ovirtsdk4.DISKFORMAT_COW):
+		return ovirtsdk4.DISKFORMAT_COW, nil
+	case string(ovirtsdk4.DISKFORMAT_RAW):
+		return ovirtsdk4.DISKFORMAT_RAW, nil
+	}
+	return "", fmt.Errorf("unknown disk format %q (valid: cow, raw)", value)
+}
+
+// Provisioning types accepted in the ProvisioningType column.
+const (
+	provisioningClone = "clone" // The boot disk is an independent copy of the template's
+	provisioningThin  = "thin"  // The boot disk is a qcow2 overlay on the template's
+)
+
+// parseProvisioningType validates the ProvisioningType column, defaulting to
+// clone when the value is empty.
+func parseProvisioningType(value string) (string, error) {
+	switch strings.ToLower(value) {
+	case "", provisioningClone:
+		return provisioningClone, nil
+	case provisioningThin:
+		return provisioningThin, nil
+	}
+	return "", fmt.Errorf("unknown provisioning type %q (valid: clone, thin)", value)
+}
+
+// thinProblems checks the parts of a thin-provisioned row that can be judged
+// without the engine. The overlay has to be a sparse cow disk on top of a
+// template disk, so Blank VMs and raw or preallocated boot disks are rejected.
+func thinProblems(vm VMParams) []string {
+	var problems []string
+	if vm.blankTemplate() {
+		problems = append(problems, "thin provisioning requires a template with a disk")
+	}
+	format, sparse := vm.DiskFormat, vm.Sparse
+	if len(vm.Disks) > 0 {
+		format, sparse = vm.Disks[0].Format, vm.Disks[0].Sparse
+	}
+	if format != ovirtsdk4.DISKFORMAT_COW || !sparse {
+		problems = append(problems, "thin provisioning requires a sparse cow boot disk")
+	}
+	return problems
+}
+
+// backupProblems checks that a row asking for incremental backup only has
+// cow disks, since the engine tracks changed blocks in the qcow2 format.
+// Disks cloned from the template are checked once the template is known.
+func backupProblems(vm VMParams) []string {
+	if len(vm.Disks) == 0 {
+		if vm.DiskFormat != ovirtsdk4.DISKFORMAT_COW {
+			return []string{"Backup requires cow disks"}
+		}
+		return nil
+	}
+	var problems []string
+	for i, disk := range vm.Disks {
+		if disk.Format != ovirtsdk4.DISKFORMAT_COW {
+			problems = append(problems, fmt.Sprintf("Backup requires cow disks, but disk %d is %s", i+1, disk.Format))
+		}
+	}
+	return problems
+}
+
+// checkThinStorage makes sure the template's boot disk has a copy on the
+// storage domain chosen for the boot disk, since a thin overlay must live
+// next to the disk it depends on.
+func checkThinStorage(templateName string, disk templateDisk, storageDomain *ovirtsdk4.StorageDomain) error {
+	domainName, _ := storageDomain.Name()
+	domainID, _ := storageDomain.Id()
+	for _, id := range disk.StorageDomains {
+		if id == domainID {
+			return nil
+		}
+	}
+	return fmt.Errorf("thin provisioning needs the disk of template %s on storage domain %s; copy it there or use clone", templateName, domainName)
+}
+
+// isBlockStorage reports whether the storage domain is backed by block
+// storage, where raw disks must be preallocated.
+func isBlockStorage(storageDomain *ovirtsdk4.StorageDomain) bool {
+	storage, ok := storageDomain.Storage()
+	if !ok {
+		return false
+	}
+	storageType, _ := storage.Type()
+	return storageType == ovirtsdk4.STORAGETYPE_ISCSI || storageType == ovirtsdk4.STORAGETYPE_FCP
+}
+
+// parseDisks parses a Disks column value of the form
+// "size[:interface[:storage_domain]];..." such as "100:virtio;500:virtio_scsi".
+// Sizes use the same units as the Size column, entries without an interface
+// use the interface of defaults, and format and sparseness come from defaults.
+func parseDisks(value string, defaults diskSpec) ([]diskSpec, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var disks []diskSpec
+	for i, entry := range strings.Split(value, ";") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("disk %d: expected size[:interface[:storage_domain]], got %q", i+1, entry)
+		}
+
+		size, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("disk %d: invalid size %q: %w", i+1, parts[0], err)
+		}
+
+		disk := defaults
+		disk.Size = size
+		if len(parts) > 1 && parts[1] != "" {
+			disk.Interface, err = parseDiskInterface(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("disk %d: %w", i+1, err)
+			}
+		}
+		if len(parts) > 2 {
+			disk.StorageDomain = parts[2]
+		}
+		disks = append(disks, disk)
+	}
+	return disks, nil
+}
+
+// waitForDisksReady polls the VM's disks until none of them is locked, which
+// is how the engine marks disks that are still being copied from a template.
+// An illegal disk fails immediately since it will never become usable.
+func waitForDisksReady(ctx context.Context, vmService *ovirtsdk4.VmService, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := vmService.DiskAttachmentsService().List().Follow("disk").Send()
+		if err != nil {
+			return err
+		}
+
+		var locked []string
+		if attachments, ok := resp.Attachments(); ok {
+			for _, attachment := range attachments.Slice() {
+				disk, ok := attachment.Disk()
+				if !ok {
+					continue
+				}
+				name, _ := disk.Name()
+				switch status, _ := disk.Status(); status {
+				case ovirtsdk4.DISKSTATUS_ILLEGAL:
+					return fmt.Errorf("disk %s is in an illegal state", name)
+				case ovirtsdk4.DISKSTATUS_LOCKED:
+					locked = append(locked, name)
+				}
+			}
+		}
+		if len(locked) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("disk still locked after %s: %s", timeout, strings.Join(locked, ", "))
+		}
+		if err := sleepContext(ctx, vmStatusPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// findStorageDomain looks up the named storage domain.
+func findStorageDomain(conn *ovirtsdk4.Connection, name string) (*ovirtsdk4.StorageDomain, error) {
+	resp, err := conn.SystemService().StorageDomainsService().List().Search("name=" + name).Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve storage domain %s: %w", name, err)
+	}
+	storageDomains, ok := resp.StorageDomains()
+	if !ok || len(storageDomains.Slice()) == 0 {
+		return nil, fmt.Errorf("storage domain %s not found", name)
+	}
+	return storageDomains.Slice()[0], nil
+}
+
+// newDiskAttachmentBuilder builds a disk attachment for the given spec. id
+// selects the template disk being overridden and is empty for new disks.
+func newDiskAttachmentBuilder(id, name string, disk diskSpec) *ovirtsdk4.DiskAttachmentBuilder {
+	diskBuilder := ovirtsdk4.NewDiskBuilder()
+	if id != "" {
+		diskBuilder.Id(id)
+	}
+	diskBuilder.Name(name)
+	diskBuilder.ProvisionedSize(disk.Size)
+	diskBuilder.Format(disk.Format)
+	diskBuilder.Sparse(disk.Sparse)
+	diskBuilder.StorageDomainsBuilderOfAny(
+		*ovirtsdk4.NewStorageDomainBuilder().Name(disk.StorageDomain),
+	)
+	if disk.QuotaID != "" {
+		diskBuilder.QuotaBuilder(ovirtsdk4.NewQuotaBuilder().Id(disk.QuotaID))
+	}
+	if disk.DiskProfileID != "" {
+		diskBuilder.DiskProfileBuilder(ovirtsdk4.NewDiskProfileBuilder().Id(disk.DiskProfileID))
+	}
+	if disk.WipeAfterDelete != nil {
+		diskBuilder.WipeAfterDelete(*disk.WipeAfterDelete)
+	}
+	if disk.Backup != nil {
+		backup := ovirtsdk4.DISKBACKUP_NONE
+		if *disk.Backup {
+			backup = ovirtsdk4.DISKBACKUP_INCREMENTAL
+		}
+		diskBuilder.Backup(backup)
+	}
+	return ovirtsdk4.NewDiskAttachmentBuilder().DiskBuilder(diskBuilder).Interface(disk.Interface)
+}
+
+// rowDisks returns the row's disks with the row-wide disk settings filled
+// in, and the storage domains they go on, making sure each domain exists.
+// Without a Disks column the VM gets a single boot disk sized by the Size
+// column. The disks are copied to keep a caller's VMParams unchanged.
+func rowDisks(conn *ovirtsdk4.Connection, vmParams VMParams, lookups *lookupCache) ([]diskSpec, map[string]*ovirtsdk4.StorageDomain, error) {
+	disks := append([]diskSpec(nil), vmParams.Disks...)
+	if len(disks) == 0 {
+		disks = []diskSpec{{
+			Size:      vmParams.Size,
+			Interface: vmParams.DiskInterface,
+			Format:    vmParams.DiskFormat,
+			Sparse:    vmParams.Sparse,
+		}}
+	}
+
+	storageDomains := make(map[string]*ovirtsdk4.StorageDomain)
+	for i := range disks {
+		disks[i].WipeAfterDelete = vmParams.WipeAfterDelete
+		disks[i].Backup = vmParams.Backup
+		if disks[i].StorageDomain == "" {
+			disks[i].StorageDomain = vmParams.StorageDomain
+		}
+		storageDomainName := disks[i].StorageDomain
+		if storageDomainName == "" {
+			return nil, nil, fmt.Errorf("no storage domain configured for VM %s: set the StorageDomain column or --storage-domain", vmParams.Name)
+		}
+		storageDomain, ok := storageDomains[storageDomainName]
+		if !ok {
+			var err error
+			storageDomain, err = lookups.storageDomain(conn, storageDomainName)
+			if err != nil {
+				return nil, nil, err
+			}
+			storageDomains[storageDomainName] = storageDomain
+		}
+		if disks[i].Format == ovirtsdk4.DISKFORMAT_RAW && disks[i].Sparse && isBlockStorage(storageDomain) {
+			return nil, nil, fmt.Errorf("VM %s: raw disks on block storage domain %s must not be sparse", vmParams.Name, storageDomainName)
+		}
+	}
+	return disks, storageDomains, nil
+}
+
+// templateDiskAttachments builds the disk attachments of a VM cloned from a
+// template. The boot disk overrides the template's boot disk, renaming the
+// clone so VMs from the same template don't all share its disk name. The
+// template's other disks keep their size and format but are renamed and
+// placed the same way.
+func templateDiskAttachments(vmParams VMParams, templateDisks []templateDisk, disks []diskSpec) []ovirtsdk4.DiskAttachmentBuilder {
+	boot := disks[0]
+	attachments := []ovirtsdk4.DiskAttachmentBuilder{*newDiskAttachmentBuilder(templateDisks[0].ID, vmParams.diskName(0), boot)}
+	for i, td := range templateDisks[1:] {
+		spec := td.Spec
+		spec.StorageDomain = boot.StorageDomain
+		spec.QuotaID = boot.QuotaID
+		spec.DiskProfileID = boot.DiskProfileID
+		spec.WipeAfterDelete = vmParams.WipeAfterDelete
+		spec.Backup = vmParams.Backup
+		if spec.Interface == "" {
+			spec.Interface = boot.Interface
+		}
+		if spec.Format == "" {
+			spec.Format = boot.Format
+		}
+		attachments = append(attachments, *newDiskAttachmentBuilder(td.ID, vmParams.diskName(i+1), spec))
+	}
+	return attachments
+}
+
+// addDisks creates the row's disks that the clone did not bring: all but the
+// boot disk, or every disk of a Blank VM. New disks are numbered after the
+// templateDisks disks cloned from the template.
+func addDisks(vmService *ovirtsdk4.VmService, vmParams VMParams, disks []diskSpec, templateDisks int, blank bool, logger *slog.Logger) error {
+	firstNewDisk, nameOffset := 1, templateDisks-1
+	if blank {
+		firstNewDisk, nameOffset = 0, 0
+	}
+	for i := firstNewDisk; i < len(disks); i++ {
+		name := vmParams.diskName(i + nameOffset)
+		attachment, err := newDiskAttachmentBuilder("", name, disks[i]).Active(true).Bootable(i == 0).Build()
+		if err != nil {
+			return fmt.Errorf("failed to build disk %s for VM %s: %w", name, vmParams.Name, err)
+		}
+		if _, err := vmService.DiskAttachmentsService().Add().Attachment(attachment).Send(); err != nil {
+			return fmt.Errorf("failed to add disk %s to VM %s: %w", name, vmParams.Name, err)
+		}
+		logger.Info("Disk added", "event", "disk_added", "disk", name)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package ovirtvm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// EngineConfig holds the connection settings of one engine listed under
+// engines in the config file. Rows pick it by name in their Engine column.
+type EngineConfig struct {
+	URL          string `json:"url" yaml:"url"`
+	Username     string `json:"username" yaml:"username"`
+	Password     string `json:"password" yaml:"password"`
+	PasswordFile string `json:"password_file" yaml:"password_file"`
+	Insecure     bool   `json:"insecure" yaml:"insecure"`
+	CAFile       string `json:"ca_file" yaml:"ca_file"`
+}
+
+// engine returns cfg with its connection settings replaced by those of the
+// named engine. The empty name is the engine given by --url and friends.
+// Settings are replaced as a whole, so a named engine never picks up the
+// default engine's password; $OVIRT_PASSWORD still applies to both.
+func (cfg Config) engine(name string) (Config, error) {
+	if name == "" {
+		return cfg, nil
+	}
+	engine, ok := cfg.Engines[name]
+	if !ok {
+		return Config{}, fmt.Errorf("engine %s is not defined under engines in the config file", name)
+	}
+	cfg.URL = engine.URL
+	cfg.Username = engine.Username
+	cfg.Password = engine.Password
+	cfg.PasswordFile = engine.PasswordFile
+	cfg.Insecure = engine.Insecure
+	cfg.CAFile = engine.CAFile
+	return cfg, nil
+}
+
+// engineConnector resolves the password for cfg once and returns a function
+// opening connections to its engine.
+func engineConnector(cfg Config, timeout time.Duration) (func() (*ovirtsdk4.Connection, error), error) {
+	password, err := resolvePassword(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*ovirtsdk4.Connection, error) {
+		return newConnection(cfg, password, timeout)
+	}, nil
+}
+
+// engineRun is the connection pool and lookup cache for one engine a run
+// talks to. Lookups are kept per engine because the same name refers to
+// unrelated objects on different engines.
+type engineRun struct {
+	name    string // "" for the default engine
+	pool    *connPool
+	lookups *lookupCache
+	rows    []int // Indexes of the run's rows that target this engine
+}
+
+// label names the engine in log messages.
+func (e *engineRun) label() string {
+	if e.name == "" {
+		return "default"
+	}
+	return e.name
+}
+
+// subset copies the engine's rows out of vms.
+func (e *engineRun) subset(vms []VMParams) []VMParams {
+	sub := make([]VMParams, len(e.rows))
+	for i, row := range e.rows {
+		sub[i] = vms[row]
+	}
+	return sub
+}
+
+// store writes rows returned by subset, after changes, back into vms.
+func (e *engineRun) store(vms, sub []VMParams) {
+	for i, row := range e.rows {
+		vms[row] = sub[i]
+	}
+}
+
+// engineRuns groups vms by their Engine column and opens a pool of size
+// connections to each engine used. Unknown engine names are reported all
+// at once with the lines using them, before any connection is made. The
+// engines are returned in name order, the default engine first.
+func engineRuns(cfg Config, vms []VMParams, size int, timeout time.Duration) ([]*engineRun, error) {
+	refs := make(references)
+	byName := make(map[string]*engineRun)
+	for i, vm := range vms {
+		refs.add(vm.Engine, vm.line)
+		run, ok := byName[vm.Engine]
+		if !ok {
+			run = &engineRun{name: vm.Engine, lookups: &lookupCache{}}
+			byName[vm.Engine] = run
+		}
+		run.rows = append(run.rows, i)
+	}
+	if len(byName) == 0 {
+		byName[""] = &engineRun{lookups: &lookupCache{}}
+	}
+
+	var unknown []error
+	for _, name := range refs.names() {
+		if _, ok := cfg.Engines[name]; !ok {
+			unknown = append(unknown, referenceError(fmt.Errorf("engine %s is not defined under engines in the config file", name), refs[name]))
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, errors.Join(unknown...)
+	}
+
+	var runs []*engineRun
+	for _, run := range byName {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].name < runs[j].name })
+
+	for _, run := range runs {
+		err := run.open(cfg, size, timeout)
+		if err != nil {
+			closeEngines(runs)
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+// open connects the run's pool to its engine.
+func (e *engineRun) open(cfg Config, size int, timeout time.Duration) error {
+	engineCfg, err := cfg.engine(e.name)
+	if err != nil {
+		return err
+	}
+	connect, err := engineConnector(engineCfg, timeout)
+	if err == nil {
+		e.pool, err = newConnPool(size, connect)
+	}
+	if err != nil && e.name != "" {
+		return fmt.Errorf("engine %s: %w", e.name, err)
+	}
+	return err
+}
+
+// closeEngines logs out of every engine that was connected.
+func closeEngines(runs []*engineRun) {
+	for _, run := range runs {
+		if run.pool != nil {
+			run.pool.Close()
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package ovirtvm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// guestIPPollInterval is how often the guest agent's reported addresses are polled.
+const guestIPPollInterval = 10 * time.Second
+
+// expectedGuestIPs returns the addresses a started VM should report: the
+// static IPv4 and IPv6 addresses from the row, or none for DHCP rows, where
+// any reported address will do.
+func expectedGuestIPs(vmParams VMParams) []string {
+	var ips []string
+	if vmParams.BootProto == bootProtoStatic && vmParams.IP != "" {
+		ips = append(ips, vmParams.IP)
+	}
+	if vmParams.IPv6 != "" {
+		ips = append(ips, vmParams.IPv6)
+	}
+	return ips
+}
+
+// reportedGuestIPs returns the addresses the guest agent reports for the VM's
+// network devices.
+func reportedGuestIPs(vmService *ovirtsdk4.VmService) ([]string, error) {
+	resp, err := vmService.ReportedDevicesService().List().Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reported devices: %w", err)
+	}
+	var ips []string
+	if devices, ok := resp.ReportedDevice(); ok {
+		for _, device := range devices.Slice() {
+			addresses, ok := device.Ips()
+			if !ok {
+				continue
+			}
+			for _, address := range addresses.Slice() {
+				if ip, ok := address.Address(); ok {
+					ips = append(ips, ip)
+				}
+			}
+		}
+	}
+	return ips, nil
+}
+
+// missingIPs returns the entries of want that are not in reported, comparing
+// parsed addresses so differently written IPv6 addresses still match.
+func missingIPs(want, reported []string) []string {
+	var missing []string
+	for _, ip := range want {
+		found := false
+		for _, candidate := range reported {
+			if net.ParseIP(ip).Equal(net.ParseIP(candidate)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, ip)
+		}
+	}
+	return missing
+}
+
+// checkGuestIPs polls the guest agent until the VM reports every expected
+// address, or any address when none is expected. The guest configures its
+// network on first boot, so nothing is reported until cloud-init or sysprep
+// has run; a non-nil error describes what was still wrong at the timeout.
+func checkGuestIPs(ctx context.Context, vmService *ovirtsdk4.VmService, want []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		reported, err := reportedGuestIPs(vmService)
+		if err != nil {
+			return err
+		}
+		missing := missingIPs(want, reported)
+		if len(reported) > 0 && len(missing) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if len(reported) == 0 {
+				return fmt.Errorf("guest agent reported no IP address within %s", timeout)
+			}
+			return fmt.Errorf("guest agent reports %s but not the expected %s", strings.Join(reported, ", "), strings.Join(missing, ", "))
+		}
+		if err := sleepContext(ctx, guestIPPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// verifyGuestIPs waits up to timeout for a started VM to report the
+// addresses its row expects. A VM that is up but unreachable usually means
+// the injected network config was wrong, so a mismatch is a warning. A
+// timeout of 0 skips the check.
+func verifyGuestIPs(ctx context.Context, vmService *ovirtsdk4.VmService, vmParams VMParams, timeout time.Duration, logger *slog.Logger, warn func(error)) {
+	if timeout <= 0 {
+		return
+	}
+	err := checkGuestIPs(ctx, vmService, expectedGuestIPs(vmParams), timeout)
+	switch {
+	case err == nil:
+		logger.Info("Guest reported expected IP", "event", "guest_ip_verified")
+	case ctx.Err() != nil:
+		logger.Debug("Run interrupted, guest IP not verified", "event", "guest_ip_unchecked")
+	default:
+		warn(fmt.Errorf("VM %s: %w", vmParams.Name, err))
+	}
+}
@@ -0,0 +1,52 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// findInstanceType looks up the named instance type.
+func findInstanceType(conn *ovirtsdk4.Connection, name string) (*ovirtsdk4.InstanceType, error) {
+	resp, err := conn.SystemService().InstanceTypesService().List().Search("name=" + name).Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve instance type %s: %w", name, err)
+	}
+	instanceTypes, ok := resp.InstanceType()
+	if !ok || len(instanceTypes.Slice()) == 0 {
+		return nil, fmt.Errorf("instance type %s not found", name)
+	}
+	return instanceTypes.Slice()[0], nil
+}
+
+// applyInstanceType fills the CPU and memory settings the row left empty
+// from instanceType. The CPU topology is taken as a whole, so it is only
+// inherited when neither CPU Cores nor CPU Sockets is set. The filled values
+// are checked again since they were unknown when the row was parsed.
+func applyInstanceType(vmParams *VMParams, instanceType *ovirtsdk4.InstanceType) error {
+	if vmParams.CPUCores == 0 && vmParams.CPUSockets == 0 {
+		if cpu, ok := instanceType.Cpu(); ok {
+			if topology, ok := cpu.Topology(); ok {
+				cores, _ := topology.Cores()
+				sockets, _ := topology.Sockets()
+				vmParams.CPUCores, vmParams.CPUSockets = int(cores), int(sockets)
+				if threads, ok := topology.Threads(); ok && threads > 0 {
+					vmParams.CPUThreads = int(threads)
+				}
+			}
+		}
+	}
+	if vmParams.Memory == 0 {
+		vmParams.Memory, _ = instanceType.Memory()
+		if vmParams.MemoryGuaranteed == 0 {
+			if policy, ok := instanceType.MemoryPolicy(); ok {
+				vmParams.MemoryGuaranteed, _ = policy.Guaranteed()
+			}
+		}
+	}
+	if problems := validateVMParams(*vmParams); len(problems) > 0 {
+		return fmt.Errorf("invalid settings with instance type %s: %s", vmParams.InstanceType, strings.Join(problems, "; "))
+	}
+	return nil
+}
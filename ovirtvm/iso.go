@@ -0,0 +1,83 @@
+package ovirtvm
+
+import (
+	"fmt"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// findISO returns the file ID of the named ISO image, looking first in ISO
+// storage domains and then for ISO disks uploaded to data domains.
+func findISO(conn *ovirtsdk4.Connection, name string) (string, error) {
+	storageDomainsService := conn.SystemService().StorageDomainsService()
+	resp, err := storageDomainsService.List().Send()
+	if err != nil {
+		return "", fmt.Errorf("failed to list storage domains: %w", err)
+	}
+	if storageDomains, ok := resp.StorageDomains(); ok {
+		for _, storageDomain := range storageDomains.Slice() {
+			if domainType, _ := storageDomain.Type(); domainType != ovirtsdk4.STORAGEDOMAINTYPE_ISO {
+				continue
+			}
+			id, ok := storageDomain.Id()
+			if !ok {
+				continue
+			}
+			filesResp, err := storageDomainsService.StorageDomainService(id).FilesService().List().Send()
+			if err != nil {
+				return "", fmt.Errorf("failed to list files in ISO domain %s: %w", id, err)
+			}
+			files, ok := filesResp.File()
+			if !ok {
+				continue
+			}
+			for _, file := range files.Slice() {
+				fileID, _ := file.Id()
+				fileName, _ := file.Name()
+				if fileName == name || fileID == name {
+					return fileID, nil
+				}
+			}
+		}
+	}
+
+	disksResp, err := conn.SystemService().DisksService().List().Search("name=" + name).Send()
+	if err != nil {
+		return "", fmt.Errorf("failed to search disks for ISO %s: %w", name, err)
+	}
+	if disks, ok := disksResp.Disks(); ok {
+		for _, disk := range disks.Slice() {
+			if contentType, _ := disk.ContentType(); contentType == ovirtsdk4.DISKCONTENTTYPE_ISO {
+				id, _ := disk.Id()
+				return id, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("ISO %s not found in any ISO or data storage domain", name)
+}
+
+// attachISO inserts the ISO into the VM's CD-ROM drive, adding a drive if
+// the VM has none.
+func attachISO(vmService *ovirtsdk4.VmService, isoID string) error {
+	cdrom, err := ovirtsdk4.NewCdromBuilder().FileBuilder(ovirtsdk4.NewFileBuilder().Id(isoID)).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build CD-ROM: %w", err)
+	}
+
+	cdromsService := vmService.CdromsService()
+	resp, err := cdromsService.List().Send()
+	if err != nil {
+		return fmt.Errorf("failed to list CD-ROMs: %w", err)
+	}
+	if cdroms, ok := resp.Cdroms(); ok && len(cdroms.Slice()) > 0 {
+		id, _ := cdroms.Slice()[0].Id()
+		if _, err := cdromsService.CdromService(id).Update().Cdrom(cdrom).Send(); err != nil {
+			return fmt.Errorf("failed to insert ISO: %w", err)
+		}
+		return nil
+	}
+	if _, err := cdromsService.Add().Cdrom(cdrom).Send(); err != nil {
+		return fmt.Errorf("failed to add CD-ROM: %w", err)
+	}
+	return nil
+}
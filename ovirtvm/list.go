@@ -0,0 +1,141 @@
+package ovirtvm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// resourceInfo is one line of --list-* output. Fields holds the columns
+// printed after the name and ID in plain output.
+type resourceInfo struct {
+	Name    string            `json:"name"`
+	ID      string            `json:"id"`
+	Details map[string]string `json:"details,omitempty"`
+
+	fields []string
+}
+
+// lister fetches one kind of resource for the --list-* flags.
+type lister func(conn *ovirtsdk4.Connection) ([]resourceInfo, error)
+
+// listResources prints the resources returned by each lister, keyed by kind.
+// Plain output is one tab-separated line per resource so it can be grepped
+// and cut; format "json" prints a single object of arrays instead.
+func listResources(conn *ovirtsdk4.Connection, kinds []string, listers map[string]lister, format string, w io.Writer) error {
+	if format != "plain" && format != "json" {
+		return fmt.Errorf("invalid output format %q: must be plain or json", format)
+	}
+	all := make(map[string][]resourceInfo)
+	for _, kind := range kinds {
+		resources, err := listers[kind](conn)
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", kind, err)
+		}
+		all[kind] = resources
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(all)
+	}
+	for _, kind := range kinds {
+		for _, resource := range all[kind] {
+			line := append([]string{resource.Name, resource.ID}, resource.fields...)
+			if _, err := fmt.Fprintln(w, strings.Join(line, "\t")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newResourceInfo builds a resourceInfo whose details are given as
+// alternating key and value pairs, in the order they are printed.
+func newResourceInfo(name, id string, details ...string) resourceInfo {
+	info := resourceInfo{Name: name, ID: id, Details: make(map[string]string)}
+	for i := 0; i+1 < len(details); i += 2 {
+		info.Details[details[i]] = details[i+1]
+		info.fields = append(info.fields, details[i+1])
+	}
+	return info
+}
+
+func listTemplates(conn *ovirtsdk4.Connection) ([]resourceInfo, error) {
+	resp, err := conn.SystemService().TemplatesService().List().Send()
+	if err != nil {
+		return nil, err
+	}
+	var resources []resourceInfo
+	if templates, ok := resp.Templates(); ok {
+		for _, template := range templates.Slice() {
+			name, _ := template.Name()
+			id, _ := template.Id()
+			description, _ := template.Description()
+			var version string
+			if v, ok := template.Version(); ok {
+				if number, ok := v.VersionNumber(); ok {
+					version = strconv.FormatInt(number, 10)
+				}
+			}
+			resources = append(resources, newResourceInfo(name, id, "version", version, "description", description))
+		}
+	}
+	return resources, nil
+}
+
+func listClusters(conn *ovirtsdk4.Connection) ([]resourceInfo, error) {
+	resp, err := conn.SystemService().ClustersService().List().Send()
+	if err != nil {
+		return nil, err
+	}
+	var resources []resourceInfo
+	if clusters, ok := resp.Clusters(); ok {
+		for _, cluster := range clusters.Slice() {
+			name, _ := cluster.Name()
+			id, _ := cluster.Id()
+			var cpuType, version string
+			if cpu, ok := cluster.Cpu(); ok {
+				cpuType, _ = cpu.Type()
+			}
+			if v, ok := cluster.Version(); ok {
+				major, _ := v.Major()
+				minor, _ := v.Minor()
+				version = fmt.Sprintf("%d.%d", major, minor)
+			}
+			resources = append(resources, newResourceInfo(name, id, "version", version, "cpu_type", cpuType))
+		}
+	}
+	return resources, nil
+}
+
+func listStorageDomains(conn *ovirtsdk4.Connection) ([]resourceInfo, error) {
+	resp, err := conn.SystemService().StorageDomainsService().List().Send()
+	if err != nil {
+		return nil, err
+	}
+	var resources []resourceInfo
+	if domains, ok := resp.StorageDomains(); ok {
+		for _, domain := range domains.Slice() {
+			name, _ := domain.Name()
+			id, _ := domain.Id()
+			domainType, _ := domain.Type()
+			var storageType string
+			if storage, ok := domain.Storage(); ok {
+				t, _ := storage.Type()
+				storageType = string(t)
+			}
+			var available string
+			if bytes, ok := domain.Available(); ok {
+				available = strconv.FormatInt(bytes, 10)
+			}
+			resources = append(resources, newResourceInfo(name, id, "type", string(domainType), "storage_type", storageType, "available_bytes", available))
+		}
+	}
+	return resources, nil
+}
@@ -0,0 +1,37 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// setupLogging installs a default logger that drops records below level
+// ("debug", "info", "warn" or "error") and writes them as key=value text or,
+// with format "json", one JSON object per line. Each record is written with a
+// single Write call, so lines from concurrent workers never interleave.
+func setupLogging(level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: must be debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q: must be text or json", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// fatal logs msg and err at error level and exits with a non-zero status.
+func fatal(msg string, err error) {
+	slog.Error(msg, "event", "fatal", "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,108 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the per-VM duration
+// histogram. Template clones take minutes, so the buckets reach an hour.
+var durationBuckets = []float64{30, 60, 120, 300, 600, 1200, 1800, 3600}
+
+// formatMetrics renders the outcome of a run in the Prometheus text format.
+// The counters cover this run only; a textfile collector exposes whatever
+// the last run wrote, which ovirt_vm_run_timestamp_seconds dates.
+func formatMetrics(results []vmResult, elapsed time.Duration, finished time.Time) string {
+	var created, validated, deleted, skipped, unfinished, failed int
+	var durations []float64
+	for _, result := range results {
+		switch result.Status {
+		case statusCreated, statusStarted, statusSealed:
+			created++
+		case statusValidated:
+			validated++
+		case statusDeleted:
+			deleted++
+		case statusSkipped, statusMissing:
+			skipped++
+		case statusCancelled, statusPending:
+			unfinished++
+			continue
+		case statusFailed:
+			failed++
+		}
+		durations = append(durations, result.Seconds)
+	}
+
+	var b strings.Builder
+	counter := func(name, help string, value int) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatFloat(value))
+	}
+	counter("ovirt_vm_created_total", "VMs created by the run.", created)
+	counter("ovirt_vm_validated_total", "VMs checked by a dry run.", validated)
+	counter("ovirt_vm_deleted_total", "VMs deleted by the run.", deleted)
+	counter("ovirt_vm_skipped_total", "VMs skipped because they already existed, or were already gone when deleting.", skipped)
+	counter("ovirt_vm_unfinished_total", "VMs the run did not finish before it was interrupted or timed out.", unfinished)
+	counter("ovirt_vm_failed_total", "VMs that failed.", failed)
+
+	const histogram = "ovirt_vm_provision_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %s Time spent on each VM the run finished, successful or not.\n# TYPE %s histogram\n", histogram, histogram)
+	var sum float64
+	for _, d := range durations {
+		sum += d
+	}
+	for _, bound := range durationBuckets {
+		count := 0
+		for _, d := range durations {
+			if d <= bound {
+				count++
+			}
+		}
+		fmt.Fprintf(&b, "%s_bucket{le=\"%s\"} %d\n", histogram, formatFloat(bound), count)
+	}
+	fmt.Fprintf(&b, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %s\n%s_count %d\n", histogram, len(durations), histogram, formatFloat(sum), histogram, len(durations))
+
+	gauge("ovirt_vm_run_duration_seconds", "Wall-clock duration of the run.", elapsed.Seconds())
+	gauge("ovirt_vm_run_timestamp_seconds", "Unix time at which the run finished.", float64(finished.Unix()))
+	return b.String()
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// writeMetrics writes the run's metrics to filename. The file is written
+// under a temporary name in the same directory and renamed into place, so a
+// collector never reads a partial file. The temporary name does not end in
+// .prom, which keeps node_exporter from picking it up.
+func writeMetrics(filename string, results []vmResult, elapsed time.Duration) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(formatMetrics(results, elapsed, time.Now())); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	// CreateTemp makes the file private; collectors usually run as another user
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return nil
+}
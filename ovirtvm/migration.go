@@ -0,0 +1,46 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// migrationPolicies lists the placement affinities accepted in the
+// MigrationPolicy column.
+var migrationPolicies = []ovirtsdk4.VmAffinity{
+	ovirtsdk4.VMAFFINITY_MIGRATABLE,
+	ovirtsdk4.VMAFFINITY_USER_MIGRATABLE,
+	ovirtsdk4.VMAFFINITY_PINNED,
+}
+
+// parseMigrationPolicy maps a CSV value to an SDK VM affinity. An empty value
+// keeps VMs with a Host pinned to it, as before the column existed, and
+// makes all other VMs migratable.
+func parseMigrationPolicy(value, host string) (ovirtsdk4.VmAffinity, error) {
+	if value == "" {
+		if host != "" {
+			return ovirtsdk4.VMAFFINITY_PINNED, nil
+		}
+		return ovirtsdk4.VMAFFINITY_MIGRATABLE, nil
+	}
+	valid := make([]string, 0, len(migrationPolicies))
+	for _, policy := range migrationPolicies {
+		if strings.EqualFold(value, string(policy)) {
+			return policy, nil
+		}
+		valid = append(valid, string(policy))
+	}
+	return "", fmt.Errorf("unknown migration policy %q (valid: %s)", value, strings.Join(valid, ", "))
+}
+
+// newPlacementPolicyBuilder builds the VM's placement policy, pinning it to
+// hostID when that is set.
+func newPlacementPolicyBuilder(policy ovirtsdk4.VmAffinity, hostID string) *ovirtsdk4.VmPlacementPolicyBuilder {
+	placementBuilder := ovirtsdk4.NewVmPlacementPolicyBuilder().Affinity(policy)
+	if hostID != "" {
+		placementBuilder.HostsBuilderOfAny(*ovirtsdk4.NewHostBuilder().Id(hostID))
+	}
+	return placementBuilder
+}
@@ -0,0 +1,85 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// nicInterfaces lists the NIC models accepted in the CSV.
+var nicInterfaces = []ovirtsdk4.NicInterface{
+	ovirtsdk4.NICINTERFACE_E1000,
+	ovirtsdk4.NICINTERFACE_PCI_PASSTHROUGH,
+	ovirtsdk4.NICINTERFACE_RTL8139,
+	ovirtsdk4.NICINTERFACE_RTL8139_VIRTIO,
+	ovirtsdk4.NICINTERFACE_SPAPR_VLAN,
+	ovirtsdk4.NICINTERFACE_VIRTIO,
+}
+
+// parseNicInterface maps a CSV value to an SDK NIC interface, defaulting to
+// virtio when the value is empty.
+func parseNicInterface(value string) (ovirtsdk4.NicInterface, error) {
+	if value == "" {
+		return ovirtsdk4.NICINTERFACE_VIRTIO, nil
+	}
+	valid := make([]string, 0, len(nicInterfaces))
+	for _, iface := range nicInterfaces {
+		if strings.EqualFold(value, string(iface)) {
+			return iface, nil
+		}
+		valid = append(valid, string(iface))
+	}
+	return "", fmt.Errorf("unknown nic interface %q (valid: %s)", value, strings.Join(valid, ", "))
+}
+
+// findVnicProfile resolves a vnic profile by name within the data center of the
+// given cluster, since profile names are only unique per network.
+func findVnicProfile(conn *ovirtsdk4.Connection, cluster *ovirtsdk4.Cluster, profileName string) (*ovirtsdk4.VnicProfile, error) {
+	clusterName, _ := cluster.Name()
+	clusterDataCenter, ok := cluster.DataCenter()
+	if !ok {
+		return nil, fmt.Errorf("cluster %s has no data center", clusterName)
+	}
+	dataCenterID, _ := clusterDataCenter.Id()
+
+	profilesResponse, err := conn.SystemService().VnicProfilesService().List().Follow("network").Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve vnic profiles: %w", err)
+	}
+
+	var profiles []*ovirtsdk4.VnicProfile
+	if profileSlice, ok := profilesResponse.Profiles(); ok {
+		profiles = profileSlice.Slice()
+	}
+
+	var available []string
+	for _, profile := range profiles {
+		network, ok := profile.Network()
+		if !ok {
+			continue
+		}
+		dataCenter, ok := network.DataCenter()
+		if !ok {
+			continue
+		}
+		if id, _ := dataCenter.Id(); id != dataCenterID {
+			continue
+		}
+		name, _ := profile.Name()
+		if name == profileName {
+			return profile, nil
+		}
+		available = append(available, name)
+	}
+	return nil, fmt.Errorf("vnic profile %s not found in the data center of cluster %s (available: %s)", profileName, clusterName, strings.Join(available, ", "))
+}
+
+// newNicBuilder builds the VM's NIC. It takes the name of the template's
+// NIC so the clone's NIC is replaced rather than a second one added.
+func newNicBuilder(name string, nicInterface ovirtsdk4.NicInterface, vnicProfileID string) *ovirtsdk4.NicBuilder {
+	return ovirtsdk4.NewNicBuilder().
+		Name(name).
+		Interface(nicInterface).
+		VnicProfileBuilder(ovirtsdk4.NewVnicProfileBuilder().Id(vnicProfileID))
+}
@@ -0,0 +1,171 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// vcpuPin pins one virtual CPU to a set of physical CPUs on the pinned host.
+type vcpuPin struct {
+	VCPU   int
+	CPUSet string // libvirt cpuset syntax, e.g. "2", "2,3" or "4-7"
+	maxCPU int    // Highest physical CPU referenced by CPUSet
+}
+
+// parseCPUPinning parses a CpuPinning value of the form
+// "vcpu:cpuset;vcpu:cpuset;...", e.g. "0:2;1:3;2:4-5".
+func parseCPUPinning(value string) ([]vcpuPin, error) {
+	var pins []vcpuPin
+	seen := make(map[int]bool)
+	for _, entry := range splitList(value) {
+		vcpuText, cpuSet, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid pin %q: want vcpu:cpuset", entry)
+		}
+		vcpu, err := strconv.Atoi(strings.TrimSpace(vcpuText))
+		if err != nil || vcpu < 0 {
+			return nil, fmt.Errorf("invalid pin %q: vcpu must be a non-negative integer", entry)
+		}
+		if seen[vcpu] {
+			return nil, fmt.Errorf("vcpu %d is pinned more than once", vcpu)
+		}
+		seen[vcpu] = true
+
+		cpuSet = strings.TrimSpace(cpuSet)
+		maxCPU, err := cpuSetMax(cpuSet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pin %q: %w", entry, err)
+		}
+		pins = append(pins, vcpuPin{VCPU: vcpu, CPUSet: cpuSet, maxCPU: maxCPU})
+	}
+	return pins, nil
+}
+
+// cpuSetMax validates a cpuset such as "1,3-5" and returns the highest CPU in it.
+func cpuSetMax(cpuSet string) (int, error) {
+	if cpuSet == "" {
+		return 0, fmt.Errorf("empty cpuset")
+	}
+	highest := -1
+	for _, part := range strings.Split(cpuSet, ",") {
+		low, high, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(low)
+		if err != nil || first < 0 {
+			return 0, fmt.Errorf("invalid cpuset %q", cpuSet)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(high)
+			if err != nil || last < first {
+				return 0, fmt.Errorf("invalid cpuset %q", cpuSet)
+			}
+		}
+		if last > highest {
+			highest = last
+		}
+	}
+	return highest, nil
+}
+
+// hostCPUCount returns the number of physical CPU threads on host.
+func hostCPUCount(host *ovirtsdk4.Host) (int, error) {
+	name, _ := host.Name()
+	cpu, ok := host.Cpu()
+	if !ok {
+		return 0, fmt.Errorf("host %s reports no CPU information", name)
+	}
+	topology, ok := cpu.Topology()
+	if !ok {
+		return 0, fmt.Errorf("host %s reports no CPU topology", name)
+	}
+	cores, _ := topology.Cores()
+	sockets, _ := topology.Sockets()
+	threads, ok := topology.Threads()
+	if !ok || threads == 0 {
+		threads = 1
+	}
+	return int(cores * sockets * threads), nil
+}
+
+// checkCPUPinning makes sure every pin refers to a physical CPU on host.
+func checkCPUPinning(host *ovirtsdk4.Host, pins []vcpuPin) error {
+	count, err := hostCPUCount(host)
+	if err != nil {
+		return err
+	}
+	name, _ := host.Name()
+	for _, pin := range pins {
+		if pin.maxCPU >= count {
+			return fmt.Errorf("vcpu %d is pinned to CPU %d but host %s only has CPUs 0-%d", pin.VCPU, pin.maxCPU, name, count-1)
+		}
+	}
+	return nil
+}
+
+// newCPUTuneBuilder builds the CpuTune holding the given pins.
+func newCPUTuneBuilder(pins []vcpuPin) *ovirtsdk4.CpuTuneBuilder {
+	var pinBuilders []ovirtsdk4.VcpuPinBuilder
+	for _, pin := range pins {
+		pinBuilders = append(pinBuilders, *ovirtsdk4.NewVcpuPinBuilder().Vcpu(int64(pin.VCPU)).CpuSet(pin.CPUSet))
+	}
+	return ovirtsdk4.NewCpuTuneBuilder().VcpuPinsBuilderOfAny(pinBuilders...)
+}
+
+// addNumaNodes splits the VM's vCPUs and memory evenly across count virtual
+// NUMA nodes. When the VM is pinned to a host, virtual node i is pinned to the
+// host's NUMA node i.
+func addNumaNodes(vmService *ovirtsdk4.VmService, vmParams VMParams, count int, pinToHost bool) error {
+	vcpus := vmParams.vcpus()
+	memoryMB := vmParams.Memory / int64(count) / (1 << 20)
+	for i := 0; i < count; i++ {
+		var cores []ovirtsdk4.CoreBuilder
+		for c := i * vcpus / count; c < (i+1)*vcpus/count; c++ {
+			cores = append(cores, *ovirtsdk4.NewCoreBuilder().Index(int64(c)))
+		}
+		nodeBuilder := ovirtsdk4.NewVirtualNumaNodeBuilder().
+			Index(int64(i)).
+			Memory(memoryMB).
+			CpuBuilder(ovirtsdk4.NewCpuBuilder().CoresBuilderOfAny(cores...))
+		if pinToHost {
+			nodeBuilder.NumaNodePinsBuilderOfAny(*ovirtsdk4.NewNumaNodePinBuilder().Index(int64(i)))
+		}
+		node, err := nodeBuilder.Build()
+		if err != nil {
+			return fmt.Errorf("failed to build NUMA node %d: %w", i, err)
+		}
+		if _, err := vmService.NumaNodesService().Add().Node(node).Send(); err != nil {
+			return fmt.Errorf("failed to add NUMA node %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// hostNumaNodeCount returns how many NUMA nodes host has.
+func hostNumaNodeCount(conn *ovirtsdk4.Connection, host *ovirtsdk4.Host) (int, error) {
+	hostID, _ := host.Id()
+	resp, err := conn.SystemService().HostsService().HostService(hostID).NumaNodesService().List().Send()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list NUMA nodes: %w", err)
+	}
+	nodes, ok := resp.Nodes()
+	if !ok {
+		return 0, nil
+	}
+	return len(nodes.Slice()), nil
+}
+
+// newCPUBuilder builds the VM's CPU topology, along with its CPU type and
+// pins when the row sets them.
+func newCPUBuilder(vmParams VMParams) *ovirtsdk4.CpuBuilder {
+	cpuBuilder := ovirtsdk4.NewCpuBuilder().TopologyBuilder(ovirtsdk4.NewCpuTopologyBuilder().Cores(int64(vmParams.CPUCores)).Sockets(int64(vmParams.CPUSockets)).Threads(int64(vmParams.CPUThreads)))
+	if vmParams.CPUType != "" {
+		cpuBuilder.Type(vmParams.CPUType)
+	}
+	if len(vmParams.CPUPinning) > 0 {
+		cpuBuilder.CpuTuneBuilder(newCPUTuneBuilder(vmParams.CPUPinning))
+	}
+	return cpuBuilder
+}
@@ -0,0 +1,128 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"log/slog"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// storageCandidate is a data storage domain --auto-storage may place disks on.
+type storageCandidate struct {
+	name        string
+	free        int64 // Bytes available, less what this run has already placed there
+	dataCenters map[string]bool
+}
+
+// diskDemand returns the provisioned bytes of the row's disks that have no
+// storage domain of their own and so follow the VM's StorageDomain.
+func diskDemand(vm VMParams) int64 {
+	if len(vm.Disks) == 0 {
+		return vm.Size
+	}
+	var total int64
+	for _, disk := range vm.Disks {
+		if disk.StorageDomain == "" {
+			total += disk.Size
+		}
+	}
+	return total
+}
+
+// listStorageCandidates returns the engine's data storage domains that report
+// their free space.
+func listStorageCandidates(conn *ovirtsdk4.Connection) ([]*storageCandidate, error) {
+	resp, err := conn.SystemService().StorageDomainsService().List().Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage domains: %w", err)
+	}
+	var candidates []*storageCandidate
+	if domains, ok := resp.StorageDomains(); ok {
+		for _, domain := range domains.Slice() {
+			if domainType, _ := domain.Type(); domainType != ovirtsdk4.STORAGEDOMAINTYPE_DATA {
+				continue
+			}
+			available, ok := domain.Available()
+			if !ok {
+				continue
+			}
+			name, _ := domain.Name()
+			candidate := &storageCandidate{name: name, free: available, dataCenters: make(map[string]bool)}
+			if dataCenters, ok := domain.DataCenters(); ok {
+				for _, dataCenter := range dataCenters.Slice() {
+					if id, ok := dataCenter.Id(); ok {
+						candidate.dataCenters[id] = true
+					}
+				}
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates, nil
+}
+
+// autoPlaceStorage gives every row without a storage domain the data domain
+// in its cluster's data center with the most free space. Rows are placed in
+// input order and each placement, as well as every explicit assignment in the
+// batch, is subtracted from the domain's free space, so one domain is not
+// picked for more than it can hold. Sizes are provisioned sizes, which
+// overstates what sparse disks use at first. Rows that fit nowhere are
+// returned as errors and left unassigned.
+func autoPlaceStorage(conn *ovirtsdk4.Connection, lookups *lookupCache, vms []VMParams) ([]error, error) {
+	candidates, err := listStorageCandidates(conn)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*storageCandidate, len(candidates))
+	for _, candidate := range candidates {
+		byName[candidate.name] = candidate
+	}
+
+	// Space claimed explicitly by the batch is not available to placed rows
+	for _, vm := range vms {
+		for _, disk := range vm.Disks {
+			if candidate, ok := byName[disk.StorageDomain]; ok {
+				candidate.free -= disk.Size
+			}
+		}
+		if candidate, ok := byName[vm.StorageDomain]; ok {
+			candidate.free -= diskDemand(vm)
+		}
+	}
+
+	var problems []error
+	for i := range vms {
+		vm := &vms[i]
+		if vm.StorageDomain != "" {
+			continue
+		}
+		cluster, err := lookups.cluster(conn, vm.Cluster, vm.DataCenter)
+		if err != nil {
+			// Reported by the pre-flight check
+			continue
+		}
+		var dataCenterID string
+		if dataCenter, ok := cluster.DataCenter(); ok {
+			dataCenterID, _ = dataCenter.Id()
+		}
+
+		need := diskDemand(*vm)
+		var best *storageCandidate
+		for _, candidate := range candidates {
+			if !candidate.dataCenters[dataCenterID] || candidate.free < need {
+				continue
+			}
+			if best == nil || candidate.free > best.free {
+				best = candidate
+			}
+		}
+		if best == nil {
+			problems = append(problems, vm.withLine(fmt.Errorf("no storage domain in the data center of cluster %s has %d bytes free for VM %s", vm.Cluster, need, vm.Name)))
+			continue
+		}
+		best.free -= need
+		vm.StorageDomain = best.name
+		slog.Debug("Placed VM on storage domain", "event", "storage_placed", "vm", vm.Name, "line", vm.line, "storage_domain", best.name, "bytes", need, "free_after", best.free)
+	}
+	return problems, nil
+}
@@ -0,0 +1,53 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// connPool hands out a fixed set of engine connections round-robin.
+//
+// A single go-ovirt Connection is safe to share once it has logged in: requests
+// go through one http.Client, but the SSO token is fetched lazily without any
+// locking, so concurrent first requests race to log in. Every connection in the
+// pool is therefore authenticated before it is handed out. The SDK also
+// disables HTTP keep-alives, so extra connections mainly add SSO sessions and
+// spread load rather than reuse sockets.
+type connPool struct {
+	conns []*ovirtsdk4.Connection
+	next  atomic.Uint64
+}
+
+// newConnPool builds size connections with build and logs each of them in.
+func newConnPool(size int, build func() (*ovirtsdk4.Connection, error)) (*connPool, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("connection pool size must be at least 1, got %d", size)
+	}
+	pool := &connPool{}
+	for i := 0; i < size; i++ {
+		conn, err := build()
+		if err == nil {
+			err = conn.Test()
+		}
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		pool.conns = append(pool.conns, conn)
+	}
+	return pool, nil
+}
+
+// get returns the next connection in the pool.
+func (p *connPool) get() *ovirtsdk4.Connection {
+	return p.conns[(p.next.Add(1)-1)%uint64(len(p.conns))]
+}
+
+// Close logs out of every connection in the pool.
+func (p *connPool) Close() {
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+}
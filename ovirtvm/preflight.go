@@ -0,0 +1,179 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// references maps the name of an engine object to the CSV lines using it.
+type references map[string][]int
+
+func (r references) add(name string, line int) {
+	if name == "" {
+		return
+	}
+	lines := r[name]
+	if len(lines) > 0 && lines[len(lines)-1] == line {
+		return
+	}
+	r[name] = append(lines, line)
+}
+
+// names returns the referenced names in sorted order so problems are
+// reported the same way on every run.
+func (r references) names() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// referenceError reports a missing or unreadable engine object together with
+// the CSV lines that refer to it.
+func referenceError(err error, lines []int) error {
+	text := make([]string, len(lines))
+	for i, line := range lines {
+		text[i] = strconv.Itoa(line)
+	}
+	return fmt.Errorf("%w (used on line %s)", err, strings.Join(text, ", "))
+}
+
+// preflight checks that every cluster, template, storage domain, instance
+// type, network, quota, QoS entry and attached disk referenced by vms exists, looking each distinct
+// name up once. It returns one error per missing reference so a typo is found
+// before any VM is created rather than partway through the batch. Successful
+// lookups are kept in lookups for the workers.
+func preflight(conn *ovirtsdk4.Connection, vms []VMParams, lookups *lookupCache) []error {
+	// Clusters are keyed by clusterKey, with a row naming each for the lookup
+	clusterRefs := make(references)
+	clusterRows := make(map[string]VMParams)
+	templateRefs := make(references)
+	templateSearchRefs := make(references)
+	storageDomainRefs := make(references)
+	instanceTypeRefs := make(references)
+	attachDiskRefs := make(references)
+	sharedDisks := make(map[string]bool)
+	// Vnic profiles, quotas and QoS entries are only unique per data center, so they are keyed by cluster
+	networkRefs := make(map[string]references)
+	quotaRefs := make(map[string]references)
+	diskQosRefs := make(map[string]references)
+	networkQosRefs := make(map[string]references)
+	for _, vm := range vms {
+		key := clusterKey(vm.Cluster, vm.DataCenter)
+		clusterRefs.add(key, vm.line)
+		clusterRows[key] = vm
+		if vm.TemplateSearch != "" {
+			templateSearchRefs.add(vm.TemplateSearch, vm.line)
+		} else if !vm.blankTemplate() {
+			templateRefs.add(vm.Template, vm.line)
+		}
+		storageDomainRefs.add(vm.StorageDomain, vm.line)
+		instanceTypeRefs.add(vm.InstanceType, vm.line)
+		for _, disk := range vm.Disks {
+			storageDomainRefs.add(disk.StorageDomain, vm.line)
+		}
+		for _, disk := range vm.AttachDisks {
+			attachDiskRefs.add(disk.ID, vm.line)
+			sharedDisks[disk.ID] = sharedDisks[disk.ID] || disk.Shared
+		}
+		if vm.Network != "" {
+			if networkRefs[key] == nil {
+				networkRefs[key] = make(references)
+			}
+			networkRefs[key].add(vm.Network, vm.line)
+		}
+		if vm.Quota != "" {
+			if quotaRefs[key] == nil {
+				quotaRefs[key] = make(references)
+			}
+			quotaRefs[key].add(vm.Quota, vm.line)
+		}
+		if vm.DiskQoS != "" {
+			if diskQosRefs[key] == nil {
+				diskQosRefs[key] = make(references)
+			}
+			diskQosRefs[key].add(vm.DiskQoS, vm.line)
+		}
+		if vm.NetworkQoS != "" {
+			if networkQosRefs[key] == nil {
+				networkQosRefs[key] = make(references)
+			}
+			networkQosRefs[key].add(vm.NetworkQoS, vm.line)
+		}
+	}
+
+	var problems []error
+	clusters := make(map[string]*ovirtsdk4.Cluster)
+	for _, key := range clusterRefs.names() {
+		vm := clusterRows[key]
+		cluster, err := lookups.cluster(conn, vm.Cluster, vm.DataCenter)
+		if err != nil {
+			problems = append(problems, referenceError(err, clusterRefs[key]))
+			continue
+		}
+		clusters[key] = cluster
+	}
+	for _, name := range templateRefs.names() {
+		if _, err := lookups.template(conn, name); err != nil {
+			problems = append(problems, referenceError(err, templateRefs[name]))
+		}
+	}
+	for _, search := range templateSearchRefs.names() {
+		if _, err := lookups.templateSearch(conn, search); err != nil {
+			problems = append(problems, referenceError(err, templateSearchRefs[search]))
+		}
+	}
+	for _, name := range storageDomainRefs.names() {
+		if _, err := lookups.storageDomain(conn, name); err != nil {
+			problems = append(problems, referenceError(err, storageDomainRefs[name]))
+		}
+	}
+	for _, name := range instanceTypeRefs.names() {
+		if _, err := lookups.instanceType(conn, name); err != nil {
+			problems = append(problems, referenceError(err, instanceTypeRefs[name]))
+		}
+	}
+	for _, id := range attachDiskRefs.names() {
+		if _, err := findAttachableDisk(conn, id, sharedDisks[id]); err != nil {
+			problems = append(problems, referenceError(err, attachDiskRefs[id]))
+		}
+	}
+	for _, key := range clusterRefs.names() {
+		cluster, ok := clusters[key]
+		if !ok {
+			// Already reported as a missing cluster
+			continue
+		}
+		refs := networkRefs[key]
+		for _, name := range refs.names() {
+			if _, err := findVnicProfile(conn, cluster, name); err != nil {
+				problems = append(problems, referenceError(err, refs[name]))
+			}
+		}
+		quotas := quotaRefs[key]
+		for _, name := range quotas.names() {
+			if _, err := findQuota(conn, cluster, name); err != nil {
+				problems = append(problems, referenceError(err, quotas[name]))
+			}
+		}
+		diskQos := diskQosRefs[key]
+		for _, name := range diskQos.names() {
+			if _, err := findQos(conn, cluster, name, ovirtsdk4.QOSTYPE_STORAGE); err != nil {
+				problems = append(problems, referenceError(err, diskQos[name]))
+			}
+		}
+		networkQos := networkQosRefs[key]
+		for _, name := range networkQos.names() {
+			if _, err := findQos(conn, cluster, name, ovirtsdk4.QOSTYPE_NETWORK); err != nil {
+				problems = append(problems, referenceError(err, networkQos[name]))
+			}
+		}
+	}
+	return problems
+}
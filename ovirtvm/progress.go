@@ -0,0 +1,95 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often a running batch reports its progress.
+const progressInterval = 10 * time.Second
+
+// shutdownGrace is how long in-flight engine calls may keep running after
+// --timeout expires before the run stops waiting for them.
+const shutdownGrace = 30 * time.Second
+
+// progress collects the results of finished VMs so long batches can show they
+// are moving and an abandoned run can still report what it got through.
+type progress struct {
+	mu         sync.Mutex
+	vms        []VMParams
+	done       []vmResult
+	total      int
+	succeeded  int
+	failed     int
+	unfinished int // Cancelled rows, counted like the summary's unfinished VMs
+}
+
+func newProgress(vms []VMParams) *progress {
+	return &progress{vms: vms, done: make([]vmResult, len(vms)), total: len(vms)}
+}
+
+// record stores the result of the VM at index i.
+func (p *progress) record(i int, result vmResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done[i] = result
+	switch result.Status {
+	case statusFailed:
+		p.failed++
+	case statusCancelled, statusPending:
+		p.unfinished++
+	default:
+		p.succeeded++
+	}
+}
+
+// results returns a copy of the results so far. VMs that have not finished
+// are reported as pending.
+func (p *progress) results() []vmResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	results := make([]vmResult, len(p.done))
+	for i, result := range p.done {
+		if result.Status == "" {
+			result = vmResult{Name: p.vms[i].Name, Line: p.vms[i].line, Status: statusPending}
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// log reports the counts so far, e.g. "completed 42/200 (40 succeeded, 2 failed)".
+// Cancelled rows are added as unfinished once there are any.
+func (p *progress) log() {
+	p.mu.Lock()
+	succeeded, failed, unfinished := p.succeeded, p.failed, p.unfinished
+	p.mu.Unlock()
+	done := succeeded + failed + unfinished
+
+	msg := fmt.Sprintf("completed %d/%d (%d succeeded, %d failed", done, p.total, succeeded, failed)
+	if unfinished > 0 {
+		msg += fmt.Sprintf(", %d unfinished", unfinished)
+	}
+	slog.Info(msg+")", "event", "progress", "completed", done, "total", p.total, "succeeded", succeeded, "failed", failed, "unfinished", unfinished)
+}
+
+// logEvery logs the progress every interval until the returned function is
+// called. Nothing is logged for batches that finish within one interval.
+func (p *progress) logEvery(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.log()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
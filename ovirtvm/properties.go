@@ -0,0 +1,51 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// customProperty is one VM custom property. Which names are accepted is
+// configured on the engine per cluster compatibility level.
+type customProperty struct {
+	Name  string
+	Value string
+}
+
+// customPropertyName matches the property names the engine accepts.
+var customPropertyName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// parseCustomProperties parses a CustomProperties value of the form
+// "name=value;name2=value2".
+func parseCustomProperties(value string) ([]customProperty, error) {
+	var properties []customProperty
+	seen := make(map[string]bool)
+	for _, entry := range splitList(value) {
+		name, propertyValue, ok := strings.Cut(entry, "=")
+		name, propertyValue = strings.TrimSpace(name), strings.TrimSpace(propertyValue)
+		if !ok || propertyValue == "" {
+			return nil, fmt.Errorf("invalid custom property %q: want name=value", entry)
+		}
+		if !customPropertyName.MatchString(name) {
+			return nil, fmt.Errorf("invalid custom property name %q: only letters, digits and underscores are allowed", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("custom property %s is set more than once", name)
+		}
+		seen[name] = true
+		properties = append(properties, customProperty{Name: name, Value: propertyValue})
+	}
+	return properties, nil
+}
+
+// newCustomPropertyBuilders builds the VM's custom properties.
+func newCustomPropertyBuilders(properties []customProperty) []ovirtsdk4.CustomPropertyBuilder {
+	var builders []ovirtsdk4.CustomPropertyBuilder
+	for _, property := range properties {
+		builders = append(builders, *ovirtsdk4.NewCustomPropertyBuilder().Name(property.Name).Value(property.Value))
+	}
+	return builders
+}
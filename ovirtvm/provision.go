@@ -0,0 +1,796 @@
+package ovirtvm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+	"golang.org/x/time/rate"
+)
+
+// VMParams describes one VM to create, as read from one input row.
+type VMParams struct {
+	Name             string
+	Template         string
+	Cluster          string
+	Class            string
+	Nic              string // Guest interface name used in the cloud-config, e.g. eth0
+	IP               string
+	Gateway          string
+	Mask             string
+	DNS              []string // Nameservers from the DNS list and the legacy DNS1 and DNS2 columns
+	CPUCores         int
+	CPUSockets       int
+	CPUThreads       int // Threads per core; defaults to 1
+	Memory           int64
+	MemoryGuaranteed int64
+	Size             int64
+	StorageDomain    string
+	Network          string
+	Start            *bool      // Overrides --start when set
+	Disks            []diskSpec // Overrides Size when set; the first entry is the boot disk
+	DiskInterface    ovirtsdk4.DiskInterface
+	NicInterface     ovirtsdk4.NicInterface
+	DiskFormat       ovirtsdk4.DiskFormat
+	Sparse           bool
+	BootProto        string // "static" or "dhcp"
+	IPv6             string
+	IPv6Gateway      string
+	IPv6Prefix       int
+	Hostname         string   // Defaults to Name
+	SSHKeys          []string // Overrides the keys from --ssh-key-file when set
+	RootPassword     secret
+	Description      string // Defaults to a provisioning timestamp
+	Comment          string
+	Tags             []string
+	ISO              string // ISO image to insert and boot from
+	Host             string // Runs the VM on this host; see MigrationPolicy
+	AffinityGroup    string
+	HA               bool
+	HAPriority       int64  // Only used when HA is set; 0 keeps the engine default
+	MemoryMax        int64  // Upper bound for memory hot-plug; 0 keeps the engine default
+	DiskName         string // Name for the boot disk; defaults to <Name>_disk0
+	CPUPinning       []vcpuPin
+	NumaNodes        int                          // Virtual NUMA nodes to split vCPUs and memory across; 0 for none
+	CPUType          string                       // e.g. "Intel Cascadelake Server Family"; defaults to the cluster's
+	BootOrder        []ovirtsdk4.BootDevice       // Overrides the template's boot order when set
+	UserData         string                       // Contents of the CloudInitFile column's file
+	OSType           string                       // e.g. "rhel_8x64" or "windows_2019x64"; Windows guests use sysprep
+	OrgName          string                       // Windows only
+	Domain           string                       // Windows only: Active Directory domain to join
+	DomainOU         string                       // Windows only: organizational unit for the computer account
+	VMType           ovirtsdk4.VmType             // Optimization profile: server, desktop or high_performance
+	Provisioning     string                       // provisioningClone or provisioningThin
+	MigrationPolicy  ovirtsdk4.VmAffinity         // Whether the engine or users may migrate the VM
+	InstanceType     string                       // Instance type supplying CPU and memory left empty in the row
+	CustomProperties []customProperty             // Engine-defined VM custom properties, e.g. viodiskcache=writeback
+	Quota            string                       // Quota in the cluster's data center charged for the VM and its disks
+	DataCenter       string                       // Data center the cluster must belong to, for cluster names reused across data centers
+	TemplateSearch   string                       // Engine search for the template instead of Template, e.g. "tag=stable"; the newest match is used
+	SearchDomains    []string                     // DNS search domains written to the cloud-config
+	Engine           string                       // Engine from the config file's engines to create the VM on; empty for the default
+	Snapshot         string                       // Description of a snapshot taken once the VM is ready or up; overrides --snapshot-after
+	TemplateName     string                       // Seals the finished VM into a template of this name
+	TimeZone         string                       // IANA time zone, or a Windows time zone name on Windows guests
+	SerialPolicy     ovirtsdk4.SerialNumberPolicy // Where the VM's SMBIOS serial number comes from; "" keeps the template's
+	SerialNumber     string                       // Serial number for the custom serial policy
+	Console          string                       // Graphics console: vnc, spice or none for headless; "" keeps the template's
+	DiskQoS          string                       // Storage QoS for the VM's disks, applied through a disk profile using it
+	NetworkQoS       string                       // Network QoS for the NIC, applied through a vnic profile of the same network using it
+	AttachDisks      []attachedDisk               // Existing disks attached after the VM's own, such as a shared cluster LUN
+	WipeAfterDelete  *bool                        // Zeroes the VM's disks when they are removed; nil keeps the engine default
+	Backup           *bool                        // Enables incremental backup on the VM's disks; nil keeps the engine default
+
+	line   int      // CSV line the row came from, for error messages
+	record []string // Column values as read, in csvColumns order, for --output-csv
+}
+
+// rowError ties an error reported by a worker to the CSV row it came
+// from, so it can be logged with the VM name and line as separate fields.
+type rowError struct {
+	vm      string
+	line    int
+	warning bool // The VM was provisioned; only a follow-up step failed
+	err     error
+}
+
+func (e *rowError) Error() string {
+	if e.line == 0 {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+func (e *rowError) Unwrap() error { return e.err }
+
+// errorLog collects the errors and warnings reported by workers. Unlike a
+// buffered channel it can never fill up, however many a VM reports.
+type errorLog struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (l *errorLog) add(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errs = append(l.errs, err)
+}
+
+// all returns a copy of the errors collected so far, in the order they were added.
+func (l *errorLog) all() []error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]error(nil), l.errs...)
+}
+
+// vcpus returns the VM's total number of virtual CPUs.
+func (vm VMParams) vcpus() int {
+	return vm.CPUCores * vm.CPUSockets * vm.CPUThreads
+}
+
+// diskName returns the name of the VM's i-th disk. The boot disk may be named
+// by the DiskName column; the others are always numbered after the VM.
+func (vm VMParams) diskName(i int) string {
+	if i == 0 && vm.DiskName != "" {
+		return vm.DiskName
+	}
+	return fmt.Sprintf("%s_disk%d", vm.Name, i)
+}
+
+// blankTemplate reports whether the VM is built from the Blank template
+// rather than a template with disks to clone.
+func (vm VMParams) blankTemplate() bool {
+	if vm.TemplateSearch != "" {
+		return false
+	}
+	return vm.Template == "" || strings.EqualFold(vm.Template, blankTemplateName)
+}
+
+// withLine prefixes err with the CSV line the row came from, if known.
+func (vm VMParams) withLine(err error) error {
+	return &rowError{vm: vm.Name, line: vm.line, err: err}
+}
+
+// asWarning is like withLine but marks err as non-fatal.
+func (vm VMParams) asWarning(err error) error {
+	return &rowError{vm: vm.Name, line: vm.line, warning: true, err: err}
+}
+
+// secret holds a sensitive value that must never show up in logs or reports.
+type secret string
+
+func (s secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+func (s secret) GoString() string { return s.String() }
+
+func (s secret) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// createOptions holds run-wide settings that control how createVM and deleteVM behave.
+type createOptions struct {
+	DryRun         bool          // Resolve and build everything but never call the engine's Add/Start
+	Start          bool          // Start VMs after creation unless the row says otherwise
+	CreateTimeout  time.Duration // How long to wait for a new VM to leave the image_locked state
+	StartTimeout   time.Duration // How long to wait for a started VM to report up
+	GuestIPTimeout time.Duration // How long to wait for the guest agent to report the VM's IP; 0 skips the check
+	MaxRetries     int           // Retries for transient engine failures on Add/Start
+	Force          bool          // Attempt creation even when a VM with the same name exists
+	DetachOnly     bool          // In delete mode, keep the VM's disks
+	Lookups        *lookupCache  // Shared template, cluster and storage domain lookups
+	CloudInitOut   io.Writer     // Receives each Linux VM's rendered cloud-config when set
+	Snapshot       string        // Description of a snapshot to take of every new VM; "" for none
+	SealToTemplate bool          // Seal every new VM into a template, named by TemplateName or after the VM
+	RateLimit      *rate.Limiter // Paces Add and Start calls, retries included, across all workers; nil for no limit
+
+	// Policy for affinity groups created on demand
+	AffinityPositive  bool
+	AffinityEnforcing bool
+}
+
+// vmStatusPollInterval is how often VM status is polled while waiting for a state change.
+const vmStatusPollInterval = 5 * time.Second
+
+// containsFold reports whether list contains value, ignoring case.
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// nameMatcher compiles a --name-filter pattern. Patterns wrapped in slashes,
+// such as "/^web[0-9]+$/", are regular expressions; anything else is a glob
+// in path.Match syntax, such as "web-*".
+func nameMatcher(pattern string) (func(name string) bool, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		return re.MatchString, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	return func(name string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}, nil
+}
+
+// selectRows returns the rows left after skipping the first offset and
+// keeping at most limit of the rest; a limit of 0 keeps them all.
+func selectRows(vms []VMParams, offset, limit int) ([]VMParams, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("offset must not be negative, got %d", offset)
+	}
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative, got %d", limit)
+	}
+	if offset >= len(vms) {
+		return nil, nil
+	}
+	vms = vms[offset:]
+	if limit > 0 && limit < len(vms) {
+		vms = vms[:limit]
+	}
+	return vms, nil
+}
+
+// sleepContext waits for d, returning early with the context's error if it
+// is cancelled first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitForVMStatus polls the VM until it reports the wanted status or the timeout
+// elapses. The last observed status is returned in either case.
+func waitForVMStatus(ctx context.Context, vmService *ovirtsdk4.VmService, want ovirtsdk4.VmStatus, timeout time.Duration) (ovirtsdk4.VmStatus, error) {
+	deadline := time.Now().Add(timeout)
+	var status ovirtsdk4.VmStatus
+	for {
+		resp, err := vmService.Get().Send()
+		if err != nil {
+			return status, err
+		}
+		if vm, ok := resp.Vm(); ok {
+			status, _ = vm.Status()
+		}
+		if status == want {
+			return status, nil
+		}
+		if time.Now().After(deadline) {
+			return status, fmt.Errorf("timed out after %s waiting for status %s (last status: %s)", timeout, want, status)
+		}
+		if err := sleepContext(ctx, vmStatusPollInterval); err != nil {
+			return status, err
+		}
+	}
+}
+
+// vmReferences holds the engine objects a row refers to. They are all
+// resolved before the VM is built, so a missing one fails the row before
+// anything is created.
+type vmReferences struct {
+	template       *ovirtsdk4.Template
+	templateName   string
+	blank          bool           // Blank VMs start with fresh devices and copy nothing
+	templateDisks  []templateDisk // Disks cloned from the template, boot disk first
+	vnicName       string         // Name the VM's NIC takes over from the template
+	disks          []diskSpec     // The row's disks, boot disk first, ready to build
+	storageDomains map[string]*ovirtsdk4.StorageDomain
+	cluster        *ovirtsdk4.Cluster
+	vnicProfileID  string
+	quotaID        string
+	pinnedHostID   string
+	isoID          string
+}
+
+// createVM provisions one row. It resolves everything the row refers to,
+// builds the VM and adds it, then adds the devices the clone doesn't bring
+// along, starts the VM if asked and takes any snapshot or template.
+func createVM(ctx context.Context, vmParams VMParams, conn *ovirtsdk4.Connection, opts createOptions, errs *errorLog) vmResult {
+	logger := slog.With("vm", vmParams.Name, "line", vmParams.line)
+	result := vmResult{Name: vmParams.Name, Line: vmParams.line}
+	fail := func(err error) vmResult {
+		err = vmParams.withLine(err)
+		errs.add(err)
+		result.Status = statusFailed
+		result.Error = err.Error()
+		return result
+	}
+	// warn records a problem that leaves the VM usable
+	warn := func(err error) {
+		warning := vmParams.asWarning(err)
+		errs.add(warning)
+		result.Warnings = append(result.Warnings, warning.Error())
+	}
+
+	if ctx.Err() != nil {
+		return cancelledResult(vmParams)
+	}
+
+	vmsService := conn.SystemService().VmsService()
+
+	// Skip VMs left over from an earlier run unless told to recreate them
+	if !opts.Force {
+		existingResponse, err := vmsService.List().Search("name=" + vmParams.Name).Send()
+		if err != nil {
+			return fail(fmt.Errorf("failed to check whether VM %s exists: %w", vmParams.Name, err))
+		}
+		if existing, ok := existingResponse.Vms(); ok && len(existing.Slice()) > 0 {
+			logger.Info("VM already exists, skipping", "event", "vm_skipped")
+			result.Status = statusSkipped
+			result.ID, _ = existing.Slice()[0].Id()
+			return result
+		}
+	}
+
+	refs, err := resolveReferences(conn, &vmParams, opts, logger)
+	if err != nil {
+		return fail(err)
+	}
+	vm, err := buildVM(vmParams, refs, opts, logger, warn)
+	if err != nil {
+		return fail(err)
+	}
+
+	if opts.DryRun {
+		logger.Info("[dry-run] would create VM", "event", "dry_run", "template", refs.templateName, "cluster", vmParams.Cluster,
+			"disk", vmParams.diskName(0), "storage_domain", refs.disks[0].StorageDomain, "extra_disks", len(refs.disks)-1, "vnic", refs.vnicName, "network", vmParams.Network)
+		result.Status = statusValidated
+		return result
+	}
+
+	// Last point at which an interrupted run can walk away without leaving anything behind
+	if ctx.Err() != nil {
+		return cancelledResult(vmParams)
+	}
+
+	var resp *ovirtsdk4.VmsServiceAddResponse
+	phaseStart := time.Now()
+	err = withRetry(ctx, logger, "create", opts.MaxRetries, func() error {
+		if err := waitRate(ctx, opts.RateLimit); err != nil {
+			return err
+		}
+		var err error
+		addRequest := vmsService.Add().Vm(vm)
+		if !refs.blank {
+			addRequest.Clone(vmParams.Provisioning == provisioningClone)
+		}
+		resp, err = addRequest.Send()
+		return err
+	})
+	if err != nil {
+		return fail(fmt.Errorf("failed to create VM %s: %w", vmParams.Name, err))
+	}
+
+	createdVM, ok := resp.Vm()
+	if !ok {
+		return fail(fmt.Errorf("failed to create VM %s: engine returned no VM", vmParams.Name))
+	}
+	vmID, ok := createdVM.Id()
+	if !ok {
+		return fail(fmt.Errorf("failed to create VM %s: engine returned no VM ID", vmParams.Name))
+	}
+	result.AddSeconds = time.Since(phaseStart).Seconds()
+	logger.Info("VM created", "event", "vm_created", "id", vmID, "seconds", result.AddSeconds)
+	result.ID = vmID
+
+	vmService := vmsService.VmService(vmID)
+
+	// Wait for the template clone to finish before touching the VM again
+	phaseStart = time.Now()
+	_, err = waitForVMStatus(ctx, vmService, ovirtsdk4.VMSTATUS_DOWN, opts.CreateTimeout)
+	result.ReadySeconds = time.Since(phaseStart).Seconds()
+	if err != nil {
+		return fail(fmt.Errorf("VM %s was created but did not become ready: %w", vmParams.Name, err))
+	}
+
+	if err := addDevices(conn, vmService, vmID, vmParams, refs, opts, logger, warn); err != nil {
+		return fail(err)
+	}
+
+	finish := func() vmResult {
+		if err := finishVM(ctx, conn, vmService, vmID, vmParams, opts, logger, warn, &result); err != nil {
+			return fail(err)
+		}
+		return result
+	}
+
+	start := opts.Start
+	if vmParams.Start != nil {
+		start = *vmParams.Start
+	}
+
+	// Starting, snapshotting or sealing while a disk is still being copied
+	// or added fails, so every path waits for the disks to unlock
+	phaseStart = time.Now()
+	err = waitForDisksReady(ctx, vmService, opts.CreateTimeout)
+	result.ReadySeconds += time.Since(phaseStart).Seconds()
+	if err != nil && ctx.Err() != nil {
+		logger.Warn("Run interrupted while disks were locked, leaving VM stopped", "event", "start_cancelled")
+		result.Status = statusCreated
+		return result
+	}
+	if err != nil {
+		return fail(fmt.Errorf("VM %s was created but its disks did not become ready: %w", vmParams.Name, err))
+	}
+	logger.Debug("All disks ready", "event", "disks_ready", "ready_seconds", result.ReadySeconds)
+
+	if !start {
+		logger.Info("VM is down and ready", "event", "vm_ready", "ready_seconds", result.ReadySeconds)
+		result.Status = statusCreated
+		return finish()
+	}
+	if ctx.Err() != nil {
+		logger.Warn("Run interrupted, leaving VM stopped", "event", "start_cancelled")
+		result.Status = statusCreated
+		return result
+	}
+
+	phaseStart = time.Now()
+	err = startVM(ctx, vmService, vmParams, opts, logger)
+	result.StartSeconds = time.Since(phaseStart).Seconds()
+	if err != nil {
+		return fail(err)
+	}
+	logger.Info("VM started", "event", "vm_started", "seconds", result.StartSeconds)
+	result.Status = statusStarted
+
+	verifyGuestIPs(ctx, vmService, vmParams, opts.GuestIPTimeout, logger, warn)
+	return finish()
+}
+
+// resolveReferences looks up every engine object the row refers to and
+// checks that they fit together. An instance type fills in the CPU and
+// memory settings vmParams leaves empty.
+func resolveReferences(conn *ovirtsdk4.Connection, vmParams *VMParams, opts createOptions, logger *slog.Logger) (*vmReferences, error) {
+	refs := &vmReferences{templateName: vmParams.Template, blank: vmParams.blankTemplate(), vnicName: "nic1"}
+	if refs.blank {
+		refs.templateName = blankTemplateName
+	}
+	var err error
+	if vmParams.TemplateSearch != "" {
+		refs.template, err = opts.Lookups.templateSearch(conn, vmParams.TemplateSearch)
+		if err == nil {
+			refs.templateName, _ = refs.template.Name()
+			logger.Debug("Selected template by search", "event", "template_selected", "search", vmParams.TemplateSearch, "template", refs.templateName)
+		}
+	} else {
+		refs.template, err = opts.Lookups.template(conn, refs.templateName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if vmParams.InstanceType != "" {
+		instanceType, err := opts.Lookups.instanceType(conn, vmParams.InstanceType)
+		if err != nil {
+			return nil, err
+		}
+		if err := applyInstanceType(vmParams, instanceType); err != nil {
+			return nil, fmt.Errorf("VM %s: %w", vmParams.Name, err)
+		}
+	}
+
+	refs.disks, refs.storageDomains, err = rowDisks(conn, *vmParams, opts.Lookups)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the vnic profile in the cluster's data center
+	if vmParams.Network == "" {
+		return nil, fmt.Errorf("no network configured for VM %s: set the Network column or --network", vmParams.Name)
+	}
+	refs.cluster, err = opts.Lookups.cluster(conn, vmParams.Cluster, vmParams.DataCenter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve cluster for VM %s: %w", vmParams.Name, err)
+	}
+	vnicProfile, err := findVnicProfile(conn, refs.cluster, vmParams.Network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve network for VM %s: %w", vmParams.Name, err)
+	}
+
+	if vmParams.Quota != "" {
+		quota, err := findQuota(conn, refs.cluster, vmParams.Quota)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve quota for VM %s: %w", vmParams.Name, err)
+		}
+		if err := checkQuotaCapacity(conn, quota, refs.cluster, *vmParams); err != nil {
+			return nil, fmt.Errorf("VM %s: %w", vmParams.Name, err)
+		}
+		refs.quotaID, _ = quota.Id()
+		for i := range refs.disks {
+			refs.disks[i].QuotaID = refs.quotaID
+		}
+	}
+
+	if vmParams.DiskQoS != "" {
+		qos, err := findQos(conn, refs.cluster, vmParams.DiskQoS, ovirtsdk4.QOSTYPE_STORAGE)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve disk QoS for VM %s: %w", vmParams.Name, err)
+		}
+		if err := applyDiskQos(conn, qos, refs.disks, refs.storageDomains); err != nil {
+			return nil, fmt.Errorf("VM %s: %w", vmParams.Name, err)
+		}
+	}
+	for _, disk := range vmParams.AttachDisks {
+		if _, err := findAttachableDisk(conn, disk.ID, disk.Shared); err != nil {
+			return nil, fmt.Errorf("VM %s: %w", vmParams.Name, err)
+		}
+	}
+	if vmParams.NetworkQoS != "" {
+		qos, err := findQos(conn, refs.cluster, vmParams.NetworkQoS, ovirtsdk4.QOSTYPE_NETWORK)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve network QoS for VM %s: %w", vmParams.Name, err)
+		}
+		vnicProfile, err = vnicProfileWithQos(conn, vnicProfile, qos)
+		if err != nil {
+			return nil, fmt.Errorf("VM %s: %w", vmParams.Name, err)
+		}
+	}
+
+	var templateDiskID string
+	if !refs.blank {
+		refs.templateDisks, refs.vnicName, err = templateDevices(refs.template)
+		if err != nil {
+			return nil, err
+		}
+		templateDiskID = refs.templateDisks[0].ID
+		if err := checkTemplateDisks(*vmParams, refs); err != nil {
+			return nil, fmt.Errorf("VM %s: %w", vmParams.Name, err)
+		}
+	}
+	logger.Debug("Resolved template devices", "event", "template_resolved", "template", refs.templateName, "template_disk", templateDiskID,
+		"template_disks", len(refs.templateDisks), "disk", vmParams.diskName(0), "vnic", refs.vnicName, "vnic_profile", vmParams.Network)
+
+	// The engine only reports CPU types per compatibility level, so an
+	// unreachable level skips the check rather than failing the VM
+	if vmParams.CPUType != "" {
+		supported, err := clusterCPUTypes(conn, refs.cluster)
+		if err != nil {
+			logger.Debug("Cannot validate CPU type", "event", "cpu_type_unchecked", "error", err)
+		} else if !containsFold(supported, vmParams.CPUType) {
+			return nil, fmt.Errorf("CPU type %q is not supported by cluster %s (supported: %s)", vmParams.CPUType, vmParams.Cluster, strings.Join(supported, ", "))
+		}
+	}
+
+	if vmParams.Host != "" {
+		refs.pinnedHostID, err = resolvePinnedHost(conn, refs.cluster, *vmParams)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if vmParams.ISO != "" {
+		refs.isoID, err = findISO(conn, vmParams.ISO)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve ISO for VM %s: %w", vmParams.Name, err)
+		}
+	}
+
+	var ok bool
+	refs.vnicProfileID, ok = vnicProfile.Id()
+	if !ok {
+		return nil, fmt.Errorf("vnic profile %s has no ID", vmParams.Network)
+	}
+	return refs, nil
+}
+
+// buildVM builds the VM to add from the row and the objects it refers to.
+// It refers to what was resolved by ID, so an ambiguous name can't pick a
+// different object when the engine adds the VM.
+func buildVM(vmParams VMParams, refs *vmReferences, opts createOptions, logger *slog.Logger, warn func(error)) (*ovirtsdk4.Vm, error) {
+	vmBuilder := ovirtsdk4.NewVmBuilder()
+	vmBuilder.Name(vmParams.Name)
+	description := vmParams.Description
+	if description == "" {
+		description = "Provisioned by go-oVirt-vm on " + time.Now().Format(time.RFC3339)
+	}
+	vmBuilder.Description(description)
+	if vmParams.Comment != "" {
+		vmBuilder.Comment(vmParams.Comment)
+	}
+	clusterID, _ := refs.cluster.Id()
+	templateID, _ := refs.template.Id()
+	vmBuilder.ClusterBuilder(ovirtsdk4.NewClusterBuilder().Id(clusterID))
+	vmBuilder.TemplateBuilder(ovirtsdk4.NewTemplateBuilder().Id(templateID))
+	vmBuilder.Type(vmParams.VMType)
+	if len(vmParams.CustomProperties) > 0 {
+		vmBuilder.CustomPropertiesBuilderOfAny(newCustomPropertyBuilders(vmParams.CustomProperties)...)
+	}
+	if vmParams.InstanceType != "" {
+		vmBuilder.InstanceTypeBuilder(ovirtsdk4.NewInstanceTypeBuilder().Name(vmParams.InstanceType))
+	}
+	if refs.quotaID != "" {
+		vmBuilder.QuotaBuilder(ovirtsdk4.NewQuotaBuilder().Id(refs.quotaID))
+	}
+	if vmParams.TimeZone != "" {
+		vmBuilder.TimeZoneBuilder(ovirtsdk4.NewTimeZoneBuilder().Name(vmParams.TimeZone))
+	}
+	if vmParams.SerialPolicy != "" {
+		vmBuilder.SerialNumberBuilder(newSerialNumberBuilder(vmParams.SerialPolicy, vmParams.SerialNumber))
+	}
+	vmBuilder.CpuBuilder(newCPUBuilder(vmParams))
+	vmBuilder.Memory(vmParams.Memory)
+	memoryPolicyBuilder := ovirtsdk4.NewMemoryPolicyBuilder().Guaranteed(vmParams.MemoryGuaranteed)
+	if vmParams.MemoryMax != 0 {
+		memoryPolicyBuilder.Max(vmParams.MemoryMax)
+	}
+	vmBuilder.MemoryPolicyBuilder(memoryPolicyBuilder)
+
+	// Disks from the Disks column are attached once the clone has finished.
+	// Blank VMs get all of their disks created afterwards.
+	if !refs.blank {
+		vmBuilder.DiskAttachmentsBuilderOfAny(templateDiskAttachments(vmParams, refs.templateDisks, refs.disks)...)
+	}
+
+	if vmParams.HA {
+		haBuilder := ovirtsdk4.NewHighAvailabilityBuilder().Enabled(true)
+		if vmParams.HAPriority != 0 {
+			haBuilder.Priority(vmParams.HAPriority)
+		}
+		vmBuilder.HighAvailabilityBuilder(haBuilder)
+	}
+	vmBuilder.PlacementPolicyBuilder(newPlacementPolicyBuilder(vmParams.MigrationPolicy, refs.pinnedHostID))
+	if osBuilder := newOsBuilder(vmParams, refs.isoID != "", refs.blank); osBuilder != nil {
+		vmBuilder.OsBuilder(osBuilder)
+	}
+	vmBuilder.NicsBuilderOfAny(*newNicBuilder(refs.vnicName, vmParams.NicInterface, refs.vnicProfileID))
+
+	if isWindows(vmParams.OSType) {
+		vmBuilder.InitializationBuilder(newSysprepBuilder(vmParams))
+	} else {
+		initializationBuilder, err := newCloudInitBuilder(vmParams, opts.CloudInitOut, logger, warn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build cloud-init for VM %s: %w", vmParams.Name, err)
+		}
+		vmBuilder.InitializationBuilder(initializationBuilder)
+	}
+
+	vm, err := vmBuilder.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build VM %s: %w", vmParams.Name, err)
+	}
+	return vm, nil
+}
+
+// addDevices sets up what the engine can only add to an existing VM: new
+// and attached disks, NUMA nodes, the console, the ISO, tags and the
+// affinity group. Tags and affinity groups only warn when they fail, since
+// the VM works without them.
+func addDevices(conn *ovirtsdk4.Connection, vmService *ovirtsdk4.VmService, vmID string, vmParams VMParams, refs *vmReferences, opts createOptions, logger *slog.Logger, warn func(error)) error {
+	if err := addDisks(vmService, vmParams, refs.disks, len(refs.templateDisks), refs.blank, logger); err != nil {
+		return err
+	}
+	for _, disk := range vmParams.AttachDisks {
+		if err := attachExistingDisk(vmService, disk); err != nil {
+			return fmt.Errorf("failed to attach disk %s to VM %s: %w", disk.ID, vmParams.Name, err)
+		}
+		logger.Info("Disk attached", "event", "disk_attached", "disk", disk.ID, "read_only", disk.ReadOnly)
+	}
+
+	if vmParams.NumaNodes > 0 {
+		if err := addNumaNodes(vmService, vmParams, vmParams.NumaNodes, refs.pinnedHostID != ""); err != nil {
+			return fmt.Errorf("failed to configure NUMA for VM %s: %w", vmParams.Name, err)
+		}
+		logger.Info("NUMA nodes added", "event", "numa_configured", "nodes", vmParams.NumaNodes)
+	}
+
+	if vmParams.Console != "" {
+		if err := configureConsole(vmService, vmParams.Console); err != nil {
+			return fmt.Errorf("failed to configure console for VM %s: %w", vmParams.Name, err)
+		}
+		logger.Info("Console configured", "event", "console_configured", "console", vmParams.Console)
+	}
+
+	if refs.isoID != "" {
+		if err := attachISO(vmService, refs.isoID); err != nil {
+			return fmt.Errorf("failed to attach ISO %s to VM %s: %w", vmParams.ISO, vmParams.Name, err)
+		}
+		logger.Info("ISO attached", "event", "iso_attached", "iso", vmParams.ISO)
+	}
+
+	if len(vmParams.Tags) > 0 {
+		if err := tagVM(conn, vmService, vmParams.Tags); err != nil {
+			warn(fmt.Errorf("failed to tag VM %s: %w", vmParams.Name, err))
+		} else {
+			logger.Info("VM tagged", "event", "vm_tagged", "tags", strings.Join(vmParams.Tags, ", "))
+		}
+	}
+
+	if vmParams.AffinityGroup != "" {
+		clusterID, _ := refs.cluster.Id()
+		if err := addToAffinityGroup(conn, clusterID, vmID, vmParams.AffinityGroup, opts.AffinityPositive, opts.AffinityEnforcing); err != nil {
+			warn(fmt.Errorf("failed to add VM %s to affinity group: %w", vmParams.Name, err))
+		} else {
+			logger.Info("VM added to affinity group", "event", "affinity_group_joined", "affinity_group", vmParams.AffinityGroup)
+		}
+	}
+	return nil
+}
+
+// startVM starts the VM, retrying transient failures, and waits for it to
+// come up.
+func startVM(ctx context.Context, vmService *ovirtsdk4.VmService, vmParams VMParams, opts createOptions, logger *slog.Logger) error {
+	err := withRetry(ctx, logger, "start", opts.MaxRetries, func() error {
+		if err := waitRate(ctx, opts.RateLimit); err != nil {
+			return err
+		}
+		_, err := vmService.Start().Send()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start VM %s: %w", vmParams.Name, err)
+	}
+	if _, err := waitForVMStatus(ctx, vmService, ovirtsdk4.VMSTATUS_UP, opts.StartTimeout); err != nil {
+		return fmt.Errorf("VM %s did not come up: %w", vmParams.Name, err)
+	}
+	return nil
+}
+
+// finishVM runs the steps that follow a VM being ready or up: the snapshot,
+// which only warns when it fails since the VM itself is fine, and sealing
+// into a template, which fails the row.
+func finishVM(ctx context.Context, conn *ovirtsdk4.Connection, vmService *ovirtsdk4.VmService, vmID string, vmParams VMParams, opts createOptions, logger *slog.Logger, warn func(error), result *vmResult) error {
+	snapshotID, err := takeSnapshot(ctx, vmService, vmParams, opts, logger)
+	if err != nil {
+		warn(fmt.Errorf("failed to snapshot VM %s: %w", vmParams.Name, err))
+		result.SnapshotError = err.Error()
+	}
+	result.SnapshotID = snapshotID
+
+	sealName := vmParams.TemplateName
+	if sealName == "" && opts.SealToTemplate {
+		sealName = vmParams.Name
+	}
+	if sealName == "" {
+		return nil
+	}
+	if ctx.Err() != nil {
+		logger.Warn("Run interrupted, VM not sealed", "event", "seal_cancelled")
+		return nil
+	}
+	templateID, err := sealToTemplate(ctx, conn, vmService, vmID, sealName, isWindows(vmParams.OSType), opts, logger)
+	result.TemplateID = templateID
+	if err != nil {
+		return fmt.Errorf("failed to seal VM %s into a template: %w", vmParams.Name, err)
+	}
+	logger.Info("VM sealed into template", "event", "vm_sealed", "template", sealName, "template_id", templateID)
+	result.Status = statusSealed
+	return nil
+}
+
+// logRowError logs an error or warning received from a worker.
+func logRowError(err error) {
+	rowErr, ok := err.(*rowError)
+	switch {
+	case !ok:
+		slog.Error("Provisioning error", "event", "vm_error", "error", err)
+	case rowErr.warning:
+		slog.Warn("Provisioning warning", "event", "vm_warning", "vm", rowErr.vm, "line", rowErr.line, "error", rowErr.err)
+	default:
+		slog.Error("Provisioning error", "event", "vm_error", "vm", rowErr.vm, "line", rowErr.line, "error", rowErr.err)
+	}
+}
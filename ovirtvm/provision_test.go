@@ -0,0 +1,459 @@
+package ovirtvm
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+	"gopkg.in/yaml.v3"
+)
+
+// TestErrorLogKeepsConcurrentErrors has several workers log several errors
+// each, as a VM failing to create, start and tag does, and checks that none
+// is lost. Run with -race to also catch unsynchronized access.
+func TestErrorLogKeepsConcurrentErrors(t *testing.T) {
+	const workers, perWorker = 20, 5
+	errs := &errorLog{}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				errs.add(fmt.Errorf("vm%d: error %d", w, i))
+				// Readers run alongside writers, like the final report after a timeout
+				_ = errs.all()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	all := errs.all()
+	if len(all) != workers*perWorker {
+		t.Fatalf("got %d errors, want %d", len(all), workers*perWorker)
+	}
+	seen := make(map[string]bool)
+	next := make(map[int]int) // Next error number expected from each worker
+	for _, err := range all {
+		var w, i int
+		if _, scanErr := fmt.Sscanf(err.Error(), "vm%d: error %d", &w, &i); scanErr != nil {
+			t.Fatalf("unexpected error %q", err)
+		}
+		if seen[err.Error()] {
+			t.Errorf("error %q logged twice", err)
+		}
+		seen[err.Error()] = true
+		if i != next[w] {
+			t.Errorf("vm%d: got error %d, want %d; errors of one VM must keep their order", w, i, next[w])
+		}
+		next[w] = i + 1
+	}
+	for w := 0; w < workers; w++ {
+		if next[w] != perWorker {
+			t.Errorf("vm%d: got %d errors, want %d", w, next[w], perWorker)
+		}
+	}
+}
+
+// fakeResponse is a canned engine reply. then replaces other replies once
+// it has been served, for requests that change the engine's state.
+type fakeResponse struct {
+	status int
+	body   string
+	then   map[string]fakeResponse
+}
+
+// fakeEngine serves canned XML replies keyed by method and path below the
+// API root, such as "GET /vms". Requests for anything else fail the test.
+type fakeEngine struct {
+	t         testing.TB
+	url       string
+	latency   time.Duration // Delay before each API reply, as from a busy engine
+	responses map[string]fakeResponse
+
+	mu       sync.Mutex
+	requests []string          // Method and path of each API request, in order
+	bodies   map[string]string // Body of the last request for each method and path
+}
+
+func (e *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/ovirt-engine/sso/oauth/token":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"token"}`)
+		return
+	case "/ovirt-engine/services/sso-logout":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{}`)
+		return
+	}
+
+	time.Sleep(e.latency)
+	key := r.Method + " " + strings.TrimPrefix(r.URL.Path, "/ovirt-engine/api")
+	body, _ := io.ReadAll(r.Body)
+	e.mu.Lock()
+	e.requests = append(e.requests, key)
+	e.bodies[key] = string(body)
+	resp, ok := e.responses[key]
+	for next, nextResp := range resp.then {
+		e.responses[next] = nextResp
+	}
+	e.mu.Unlock()
+	if !ok {
+		e.t.Errorf("unexpected engine request %s", key)
+		resp = fakeResponse{status: http.StatusNotFound, body: `<fault><reason>Not Found</reason></fault>`}
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	if resp.status == 0 {
+		resp.status = http.StatusOK
+	}
+	w.WriteHeader(resp.status)
+	fmt.Fprint(w, resp.body)
+}
+
+// called reports whether the engine received the given request.
+func (e *fakeEngine) called(key string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, request := range e.requests {
+		if request == key {
+			return true
+		}
+	}
+	return false
+}
+
+// body returns the body of the last request with the given method and path.
+func (e *fakeEngine) body(key string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.bodies[key]
+}
+
+// connect opens a new connection to the engine, as the tool's connector does.
+func (e *fakeEngine) connect() (*ovirtsdk4.Connection, error) {
+	return newConnection(Config{URL: e.url + "/ovirt-engine/api", Username: "admin@internal"}, "password", 10*time.Second)
+}
+
+// newFakeEngine starts a fake engine that answers every request createVM
+// makes for testVM successfully, after applying overrides, and returns it
+// with a connection to it.
+func newFakeEngine(t testing.TB, overrides map[string]fakeResponse) (*fakeEngine, *ovirtsdk4.Connection) {
+	t.Helper()
+	engine := &fakeEngine{t: t, bodies: make(map[string]string), responses: map[string]fakeResponse{
+		"GET /vms": {body: `<vms/>`},
+		"GET /templates": {body: `<templates><template id="tpl-1"><name>rhel9</name>
+			<disk_attachments><disk_attachment id="disk-1"><bootable>true</bootable><interface>virtio</interface>
+				<disk id="disk-1"><format>cow</format><sparse>true</sparse><provisioned_size>10737418240</provisioned_size>
+					<storage_domains><storage_domain id="sd-1"/></storage_domains></disk>
+			</disk_attachment></disk_attachments>
+			<nics><nic id="nic-1"><name>nic1</name></nic></nics>
+		</template></templates>`},
+		"GET /storagedomains":           {body: `<storage_domains><storage_domain id="sd-1"><name>data1</name><type>data</type><storage><type>nfs</type></storage></storage_domain></storage_domains>`},
+		"GET /clusters":                 {body: `<clusters><cluster id="cl-1"><name>prod</name><data_center id="dc-1"/></cluster></clusters>`},
+		"GET /vnicprofiles":             {body: `<vnic_profiles><vnic_profile id="vp-1"><name>ovirtmgmt</name><network id="net-1"><name>ovirtmgmt</name><data_center id="dc-1"/></network></vnic_profile></vnic_profiles>`},
+		"POST /vms":                     {status: http.StatusCreated, body: `<vm id="vm-1"><name>web1</name><status>image_locked</status></vm>`},
+		"GET /vms/vm-1":                 {body: `<vm id="vm-1"><name>web1</name><status>down</status></vm>`},
+		"GET /vms/vm-1/diskattachments": {body: `<disk_attachments/>`},
+		"POST /vms/vm-1/start": {body: `<action><status>complete</status></action>`, then: map[string]fakeResponse{
+			"GET /vms/vm-1": {body: `<vm id="vm-1"><name>web1</name><status>up</status></vm>`},
+		}},
+	}}
+	for key, resp := range overrides {
+		engine.responses[key] = resp
+	}
+	srv := httptest.NewServer(engine)
+	t.Cleanup(srv.Close)
+	engine.url = srv.URL
+
+	conn, err := engine.connect()
+	if err != nil {
+		t.Fatalf("newConnection: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return engine, conn
+}
+
+// testVM returns a DHCP row using the objects newFakeEngine serves.
+func testVM() VMParams {
+	return VMParams{
+		Name:             "web1",
+		Template:         "rhel9",
+		Cluster:          "prod",
+		Nic:              "eth0",
+		BootProto:        bootProtoDHCP,
+		CPUCores:         2,
+		CPUSockets:       1,
+		CPUThreads:       1,
+		Memory:           4294967296,
+		MemoryGuaranteed: 2147483648,
+		Size:             10737418240,
+		StorageDomain:    "data1",
+		Network:          "ovirtmgmt",
+		DiskInterface:    ovirtsdk4.DISKINTERFACE_VIRTIO,
+		NicInterface:     ovirtsdk4.NICINTERFACE_VIRTIO,
+		DiskFormat:       ovirtsdk4.DISKFORMAT_COW,
+		Sparse:           true,
+		Provisioning:     provisioningClone,
+		Hostname:         "web1",
+		line:             2,
+	}
+}
+
+// TestCreateVM runs createVM against a fake engine that either answers every
+// request or fails one step, and checks that a failed row reports the
+// engine's error and goes no further.
+func TestCreateVM(t *testing.T) {
+	fault := func(status int, detail string) fakeResponse {
+		return fakeResponse{status: status, body: `<fault><reason>Operation Failed</reason><detail>` + detail + `</detail></fault>`}
+	}
+	tests := []struct {
+		name      string
+		overrides map[string]fakeResponse
+		wantID    string
+		wantError []string // Substrings of the row's error
+		notCalled string   // A request the failure must prevent
+	}{
+		{
+			name:   "starts",
+			wantID: "vm-1",
+		},
+		{
+			name:      "template not found",
+			overrides: map[string]fakeResponse{"GET /templates": {body: `<templates/>`}},
+			wantError: []string{"line 2: template rhel9 not found"},
+			notCalled: "POST /vms",
+		},
+		{
+			name:      "add fails",
+			overrides: map[string]fakeResponse{"POST /vms": fault(http.StatusBadRequest, "[Cannot add VM. The requested name is invalid.]")},
+			wantError: []string{"line 2: failed to create VM web1", "Cannot add VM. The requested name is invalid.", `HTTP response code is "400"`},
+			notCalled: "POST /vms/vm-1/start",
+		},
+		{
+			name:      "start fails",
+			overrides: map[string]fakeResponse{"POST /vms/vm-1/start": fault(http.StatusConflict, "[Cannot run VM. There is no host that satisfies current scheduling constraints.]")},
+			wantID:    "vm-1",
+			wantError: []string{"line 2: failed to start VM web1", "no host that satisfies", `HTTP response code is "409"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, conn := newFakeEngine(t, tt.overrides)
+			errs := &errorLog{}
+			opts := createOptions{Start: true, CreateTimeout: time.Minute, StartTimeout: time.Minute}
+			result := createVM(context.Background(), testVM(), conn, opts, errs)
+
+			if result.ID != tt.wantID {
+				t.Errorf("ID = %q, want %q", result.ID, tt.wantID)
+			}
+			if tt.wantError == nil {
+				if result.Status != statusStarted || len(errs.all()) > 0 {
+					t.Errorf("status = %s, errors = %v; want %s", result.Status, errs.all(), statusStarted)
+				}
+				return
+			}
+			if result.Status != statusFailed {
+				t.Errorf("status = %s, want %s", result.Status, statusFailed)
+			}
+			for _, want := range tt.wantError {
+				if !strings.Contains(result.Error, want) {
+					t.Errorf("error %q does not contain %q", result.Error, want)
+				}
+			}
+			if logged := errs.all(); len(logged) != 1 || logged[0].Error() != result.Error {
+				t.Errorf("logged errors = %v, want just the row's error", logged)
+			}
+			if tt.notCalled != "" && engine.called(tt.notCalled) {
+				t.Errorf("engine received %s after the failure", tt.notCalled)
+			}
+		})
+	}
+}
+
+// sentVM holds the fields of a VM sent to the fake engine that the tests check.
+type sentVM struct {
+	Name     string `xml:"name"`
+	Cluster  xmlRef `xml:"cluster"`
+	Template xmlRef `xml:"template"`
+	Topology struct {
+		Cores   int64 `xml:"cores"`
+		Sockets int64 `xml:"sockets"`
+		Threads int64 `xml:"threads"`
+	} `xml:"cpu>topology"`
+	Memory     int64 `xml:"memory"`
+	Guaranteed int64 `xml:"memory_policy>guaranteed"`
+	Disks      []struct {
+		ID             string   `xml:"id,attr"`
+		Name           string   `xml:"name"`
+		Format         string   `xml:"format"`
+		StorageDomains []string `xml:"storage_domains>storage_domain>name"`
+	} `xml:"disk_attachments>disk_attachment>disk"`
+	Nics []struct {
+		Name        string `xml:"name"`
+		Interface   string `xml:"interface"`
+		VnicProfile xmlRef `xml:"vnic_profile"`
+	} `xml:"nics>nic"`
+	Initialization struct {
+		HostName     string `xml:"host_name"`
+		SSHKeys      string `xml:"authorized_ssh_keys"`
+		CustomScript string `xml:"custom_script"`
+	} `xml:"initialization"`
+}
+
+type xmlRef struct {
+	ID string `xml:"id,attr"`
+}
+
+// TestCreateVMBuildsVM checks the VM that createVM sends to the engine: the
+// resolved objects are referred to by ID, and the row's sizes, boot disk,
+// NIC and cloud-init settings are all filled in.
+func TestCreateVMBuildsVM(t *testing.T) {
+	engine, conn := newFakeEngine(t, nil)
+	vm := testVM()
+	vm.BootProto = bootProtoStatic
+	vm.IP, vm.Mask, vm.Gateway = "192.0.2.10", "255.255.255.0", "192.0.2.1"
+	vm.SSHKeys = []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5 ops@example.com"}
+	result := createVM(context.Background(), vm, conn, createOptions{CreateTimeout: time.Minute}, &errorLog{})
+	if result.Status != statusCreated {
+		t.Fatalf("status = %s (%s), want %s", result.Status, result.Error, statusCreated)
+	}
+	if engine.called("POST /vms/vm-1/start") {
+		t.Errorf("VM was started without --start or a Start column")
+	}
+
+	var sent sentVM
+	if err := xml.Unmarshal([]byte(engine.body("POST /vms")), &sent); err != nil {
+		t.Fatalf("failed to parse the VM sent to the engine: %v", err)
+	}
+	check := func(field string, got, want interface{}) {
+		t.Helper()
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", field, got, want)
+		}
+	}
+	check("name", sent.Name, "web1")
+	check("cluster", sent.Cluster.ID, "cl-1")
+	check("template", sent.Template.ID, "tpl-1")
+	check("cores", sent.Topology.Cores, int64(2))
+	check("sockets", sent.Topology.Sockets, int64(1))
+	check("threads", sent.Topology.Threads, int64(1))
+	check("memory", sent.Memory, vm.Memory)
+	check("guaranteed memory", sent.Guaranteed, vm.MemoryGuaranteed)
+
+	if len(sent.Disks) != 1 {
+		t.Fatalf("got %d disks, want the template's boot disk", len(sent.Disks))
+	}
+	check("boot disk", sent.Disks[0].ID, "disk-1")
+	check("boot disk name", sent.Disks[0].Name, "web1_disk0")
+	check("boot disk format", sent.Disks[0].Format, "cow")
+	check("boot disk storage domains", sent.Disks[0].StorageDomains, []string{"data1"})
+
+	if len(sent.Nics) != 1 {
+		t.Fatalf("got %d nics, want 1", len(sent.Nics))
+	}
+	check("nic name", sent.Nics[0].Name, "nic1")
+	check("nic interface", sent.Nics[0].Interface, "virtio")
+	check("vnic profile", sent.Nics[0].VnicProfile.ID, "vp-1")
+
+	check("host name", sent.Initialization.HostName, "web1")
+	check("SSH keys", sent.Initialization.SSHKeys, vm.SSHKeys[0])
+	var script cloudConfigDocument
+	if err := yaml.Unmarshal([]byte(sent.Initialization.CustomScript), &script); err != nil {
+		t.Fatalf("custom script is not valid YAML: %v", err)
+	}
+	if len(script.Networking.Config) != 1 {
+		t.Fatalf("custom script has %d interfaces, want 1:\n%s", len(script.Networking.Config), sent.Initialization.CustomScript)
+	}
+	check("cloud-config subnets", script.Networking.Config[0].Subnets, []cloudSubnet{
+		{Type: "static", Address: "192.0.2.10", Netmask: "255.255.255.0", Gateway: "192.0.2.1"},
+	})
+}
+
+// TestCreateVMTemplateSearch checks that a TemplateSearch row is created
+// from the most recently created of the matching templates.
+func TestCreateVMTemplateSearch(t *testing.T) {
+	template := func(id, created string) string {
+		return `<template id="` + id + `"><name>rhel9-` + id + `</name><creation_time>` + created + `</creation_time>
+			<disk_attachments><disk_attachment id="disk-` + id + `"><bootable>true</bootable><interface>virtio</interface>
+				<disk id="disk-` + id + `"><format>cow</format><sparse>true</sparse></disk>
+			</disk_attachment></disk_attachments>
+			<nics><nic id="nic-1"><name>nic1</name></nic></nics></template>`
+	}
+	engine, conn := newFakeEngine(t, map[string]fakeResponse{
+		"GET /templates": {body: `<templates>` +
+			template("tpl-old", "2024-01-01T00:00:00Z") +
+			template("tpl-new", "2024-06-01T00:00:00Z") +
+			template("tpl-mid", "2024-03-01T00:00:00Z") + `</templates>`},
+	})
+	vm := testVM()
+	vm.Template, vm.TemplateSearch = "", "tag=stable"
+	result := createVM(context.Background(), vm, conn, createOptions{CreateTimeout: time.Minute}, &errorLog{})
+	if result.Status != statusCreated {
+		t.Fatalf("status = %s (%s), want %s", result.Status, result.Error, statusCreated)
+	}
+
+	var sent sentVM
+	if err := xml.Unmarshal([]byte(engine.body("POST /vms")), &sent); err != nil {
+		t.Fatalf("failed to parse the VM sent to the engine: %v", err)
+	}
+	if sent.Template.ID != "tpl-new" {
+		t.Errorf("template = %q, want the newest match tpl-new", sent.Template.ID)
+	}
+	if len(sent.Disks) != 1 || sent.Disks[0].ID != "disk-tpl-new" {
+		t.Errorf("disks = %+v, want the boot disk of tpl-new", sent.Disks)
+	}
+}
+
+// BenchmarkProvision creates 100 VMs at a concurrency of 20 against a fake
+// engine that takes 5ms over each reply, sharing one engine connection or
+// giving each worker its own.
+func BenchmarkProvision(b *testing.B) {
+	const rows, concurrency = 100, 20
+	vms := make([]VMParams, rows)
+	for i := range vms {
+		vms[i] = testVM()
+		vms[i].Name = fmt.Sprintf("web%d", i)
+		vms[i].line = i + 2
+	}
+	// A log line per VM would bury the results
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for _, connections := range []int{1, concurrency} {
+		b.Run(fmt.Sprintf("connections=%d", connections), func(b *testing.B) {
+			engine, _ := newFakeEngine(b, nil)
+			engine.latency = 5 * time.Millisecond
+			pool, err := newConnPool(connections, engine.connect)
+			if err != nil {
+				b.Fatalf("newConnPool: %v", err)
+			}
+			defer pool.Close()
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				// A new cache each time, as each run starts with one
+				opts := createOptions{CreateTimeout: time.Minute, Lookups: &lookupCache{}}
+				errs := &errorLog{}
+				progress := newProgress(vms)
+				<-startWorkers(context.Background(), vms, concurrency, nil, progress, func(ctx context.Context, vm VMParams) vmResult {
+					return createVM(ctx, vm, pool.get(), opts, errs)
+				})
+				if logged := errs.all(); len(logged) > 0 {
+					b.Fatalf("provisioning failed: %v", logged[0])
+				}
+			}
+			b.ReportMetric(float64(rows*b.N)/b.Elapsed().Seconds(), "vms/s")
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package ovirtvm
+
+import (
+	"fmt"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// findQos looks up the named QoS entry of the given type, or the entry with
+// that ID, in the data center of cluster. Like quotas, QoS entries are
+// defined per data center.
+func findQos(conn *ovirtsdk4.Connection, cluster *ovirtsdk4.Cluster, name string, qosType ovirtsdk4.QosType) (*ovirtsdk4.Qos, error) {
+	clusterName, _ := cluster.Name()
+	clusterDataCenter, ok := cluster.DataCenter()
+	if !ok {
+		return nil, fmt.Errorf("cluster %s has no data center", clusterName)
+	}
+	dataCenterID, _ := clusterDataCenter.Id()
+
+	resp, err := conn.SystemService().DataCentersService().DataCenterService(dataCenterID).QossService().List().Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve QoS entries for cluster %s: %w", clusterName, err)
+	}
+	if qoss, ok := resp.Qoss(); ok {
+		for _, qos := range qoss.Slice() {
+			if entryType, _ := qos.Type(); entryType != qosType {
+				continue
+			}
+			qosName, _ := qos.Name()
+			qosID, _ := qos.Id()
+			if qosName == name || qosID == name {
+				return qos, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s QoS %s not found in the data center of cluster %s", qosType, name, clusterName)
+}
+
+// diskProfileWithQos returns the ID of a disk profile of storageDomain that
+// applies qos. The engine attaches storage QoS to disk profiles rather than
+// to disks, so the QoS is applied by picking the profile.
+func diskProfileWithQos(conn *ovirtsdk4.Connection, storageDomain *ovirtsdk4.StorageDomain, qos *ovirtsdk4.Qos) (string, error) {
+	domainName, _ := storageDomain.Name()
+	domainID, _ := storageDomain.Id()
+	qosName, _ := qos.Name()
+	qosID, _ := qos.Id()
+
+	resp, err := conn.SystemService().StorageDomainsService().StorageDomainService(domainID).DiskProfilesService().List().Send()
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve disk profiles of storage domain %s: %w", domainName, err)
+	}
+	if profiles, ok := resp.Profiles(); ok {
+		for _, profile := range profiles.Slice() {
+			if profileQos, ok := profile.Qos(); ok {
+				if id, _ := profileQos.Id(); id == qosID {
+					profileID, _ := profile.Id()
+					return profileID, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("no disk profile of storage domain %s uses storage QoS %s", domainName, qosName)
+}
+
+// vnicProfileWithQos returns profile if it applies qos, or else another
+// vnic profile of the same network that does. The profile's QoS is not
+// changed, since other VMs using it would be throttled too.
+func vnicProfileWithQos(conn *ovirtsdk4.Connection, profile *ovirtsdk4.VnicProfile, qos *ovirtsdk4.Qos) (*ovirtsdk4.VnicProfile, error) {
+	qosName, _ := qos.Name()
+	qosID, _ := qos.Id()
+	usesQos := func(profile *ovirtsdk4.VnicProfile) bool {
+		profileQos, ok := profile.Qos()
+		if !ok {
+			return false
+		}
+		id, _ := profileQos.Id()
+		return id == qosID
+	}
+	if usesQos(profile) {
+		return profile, nil
+	}
+
+	profileName, _ := profile.Name()
+	network, ok := profile.Network()
+	if !ok {
+		return nil, fmt.Errorf("vnic profile %s has no network", profileName)
+	}
+	networkID, _ := network.Id()
+	networkName, _ := network.Name()
+	resp, err := conn.SystemService().NetworksService().NetworkService(networkID).VnicProfilesService().List().Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve vnic profiles of network %s: %w", networkName, err)
+	}
+	if profiles, ok := resp.Profiles(); ok {
+		for _, candidate := range profiles.Slice() {
+			if usesQos(candidate) {
+				return candidate, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no vnic profile of network %s uses network QoS %s", networkName, qosName)
+}
+
+// applyDiskQos gives each disk a profile of its storage domain that applies
+// qos. Each storage domain has its own disk profiles, so the profile is
+// looked up once per domain.
+func applyDiskQos(conn *ovirtsdk4.Connection, qos *ovirtsdk4.Qos, disks []diskSpec, storageDomains map[string]*ovirtsdk4.StorageDomain) error {
+	profiles := make(map[string]string)
+	for i := range disks {
+		name := disks[i].StorageDomain
+		profileID, ok := profiles[name]
+		if !ok {
+			var err error
+			profileID, err = diskProfileWithQos(conn, storageDomains[name], qos)
+			if err != nil {
+				return err
+			}
+			profiles[name] = profileID
+		}
+		disks[i].DiskProfileID = profileID
+	}
+	return nil
+}
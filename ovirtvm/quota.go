@@ -0,0 +1,83 @@
+package ovirtvm
+
+import (
+	"fmt"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// quotaUnlimited is what the engine reports for a quota limit that is not set.
+const quotaUnlimited = -1
+
+// findQuota looks up the named quota, or the quota with that ID, in the data
+// center of cluster. Quotas are defined per data center, so the same name may
+// mean different quotas for rows in different clusters.
+func findQuota(conn *ovirtsdk4.Connection, cluster *ovirtsdk4.Cluster, name string) (*ovirtsdk4.Quota, error) {
+	clusterName, _ := cluster.Name()
+	clusterDataCenter, ok := cluster.DataCenter()
+	if !ok {
+		return nil, fmt.Errorf("cluster %s has no data center", clusterName)
+	}
+	dataCenterID, _ := clusterDataCenter.Id()
+
+	resp, err := conn.SystemService().DataCentersService().DataCenterService(dataCenterID).QuotasService().List().Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve quotas for cluster %s: %w", clusterName, err)
+	}
+	if quotas, ok := resp.Quotas(); ok {
+		for _, quota := range quotas.Slice() {
+			quotaName, _ := quota.Name()
+			quotaID, _ := quota.Id()
+			if quotaName == name || quotaID == name {
+				return quota, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("quota %s not found in the data center of cluster %s", name, clusterName)
+}
+
+// checkQuotaCapacity fails if adding the VM's vCPUs or memory would exceed a
+// cluster limit of quota that applies to cluster. Limits without a cluster
+// apply to every cluster of the data center. The engine counts only running
+// VMs against these limits, so a VM that is not started may still fit later.
+func checkQuotaCapacity(conn *ovirtsdk4.Connection, quota *ovirtsdk4.Quota, cluster *ovirtsdk4.Cluster, vmParams VMParams) error {
+	quotaName, _ := quota.Name()
+	quotaID, _ := quota.Id()
+	clusterID, _ := cluster.Id()
+	dataCenterID := ""
+	if dataCenter, ok := cluster.DataCenter(); ok {
+		dataCenterID, _ = dataCenter.Id()
+	}
+
+	quotaService := conn.SystemService().DataCentersService().DataCenterService(dataCenterID).QuotasService().QuotaService(quotaID)
+	resp, err := quotaService.QuotaClusterLimitsService().List().Send()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve limits of quota %s: %w", quotaName, err)
+	}
+	limits, ok := resp.Limits()
+	if !ok {
+		return nil
+	}
+
+	memoryGB := float64(vmParams.Memory) / (1 << 30)
+	for _, limit := range limits.Slice() {
+		if limitCluster, ok := limit.Cluster(); ok {
+			if id, _ := limitCluster.Id(); id != clusterID {
+				continue
+			}
+		}
+		if vcpuLimit, ok := limit.VcpuLimit(); ok && vcpuLimit != quotaUnlimited {
+			vcpuUsage, _ := limit.VcpuUsage()
+			if vcpuUsage+int64(vmParams.vcpus()) > vcpuLimit {
+				return fmt.Errorf("quota %s has %d of %d vCPUs in use, not enough for %d more", quotaName, vcpuUsage, vcpuLimit, vmParams.vcpus())
+			}
+		}
+		if memoryLimit, ok := limit.MemoryLimit(); ok && memoryLimit != quotaUnlimited {
+			memoryUsage, _ := limit.MemoryUsage()
+			if memoryUsage+memoryGB > memoryLimit {
+				return fmt.Errorf("quota %s has %.1f of %.1f GB memory in use, not enough for %.1f GB more", quotaName, memoryUsage, memoryLimit, memoryGB)
+			}
+		}
+	}
+	return nil
+}
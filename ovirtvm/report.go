@@ -0,0 +1,219 @@
+package ovirtvm
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Result statuses recorded for each VM in the report.
+const (
+	statusValidated = "validated" // Dry run: everything resolved but nothing was created
+	statusCreated   = "created"
+	statusStarted   = "started"
+	statusSealed    = "sealed"  // The VM was turned into a template
+	statusSkipped   = "skipped" // A VM with the same name already existed
+	statusDeleted   = "deleted"
+	statusMissing   = "missing" // Delete mode: the VM did not exist
+	statusFailed    = "failed"
+	statusCancelled = "cancelled" // The run was interrupted before the VM was touched
+	statusPending   = "pending"   // Still in progress when the run stopped waiting
+)
+
+// vmResult is the outcome of provisioning a single CSV row.
+type vmResult struct {
+	Name     string   `json:"name"`
+	Line     int      `json:"line,omitempty"` // CSV line the row came from
+	Status   string   `json:"status"`
+	ID       string   `json:"id,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"` // Non-fatal problems such as failed tagging
+	Seconds  float64  `json:"seconds,omitempty"`  // Time the worker spent on the VM
+
+	// Time spent in each phase of creating the VM
+	AddSeconds   float64 `json:"add_seconds,omitempty"`   // The Add call, including retries
+	ReadySeconds float64 `json:"ready_seconds,omitempty"` // Waiting for the clone and the VM's disks
+	StartSeconds float64 `json:"start_seconds,omitempty"` // The Start call and waiting for the VM to come up
+
+	SnapshotID    string `json:"snapshot_id,omitempty"`
+	SnapshotError string `json:"snapshot_error,omitempty"` // The VM was created but its snapshot failed
+	TemplateID    string `json:"template_id,omitempty"`    // Template the VM was sealed into
+}
+
+// cancelledResult is the result for a row the run never got to.
+func cancelledResult(vm VMParams) vmResult {
+	return vmResult{Name: vm.Name, Line: vm.line, Status: statusCancelled}
+}
+
+// summarize returns a one-line summary of the run, such as
+// "42/200 VMs created, 158 failed", and the number of failed VMs.
+// verb describes what happened to the VMs that succeeded.
+func summarize(results []vmResult, verb string) (string, int) {
+	var succeeded, skipped, unfinished, failed int
+	for _, result := range results {
+		switch result.Status {
+		case statusFailed:
+			failed++
+		case statusCancelled, statusPending:
+			unfinished++
+		case statusSkipped, statusMissing:
+			skipped++
+		default:
+			succeeded++
+		}
+	}
+	summary := fmt.Sprintf("%d/%d VMs %s", succeeded, len(results), verb)
+	if skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", skipped)
+	}
+	if unfinished > 0 {
+		summary += fmt.Sprintf(", %d unfinished", unfinished)
+	}
+	return summary + fmt.Sprintf(", %d failed", failed), failed
+}
+
+// durationStats returns the minimum, maximum, mean and 95th percentile
+// (nearest rank) of values, which must not be empty.
+func durationStats(values []float64) (lo, hi, avg, p95 float64) {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	return sorted[0], sorted[len(sorted)-1], sum / float64(len(sorted)), sorted[rank]
+}
+
+// logDurations logs min/max/avg/p95 of the total and per-phase time spent on
+// the VMs the run finished. A phase is only summarized over the VMs that
+// reached it, so the start phase ignores VMs left stopped.
+func logDurations(results []vmResult) {
+	phases := []struct {
+		name    string
+		seconds func(vmResult) float64
+	}{
+		{"total", func(r vmResult) float64 { return r.Seconds }},
+		{"add", func(r vmResult) float64 { return r.AddSeconds }},
+		{"ready", func(r vmResult) float64 { return r.ReadySeconds }},
+		{"start", func(r vmResult) float64 { return r.StartSeconds }},
+	}
+	for _, phase := range phases {
+		var values []float64
+		for _, result := range results {
+			if result.Status == statusCancelled || result.Status == statusPending {
+				continue
+			}
+			if v := phase.seconds(result); v > 0 {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		lo, hi, avg, p95 := durationStats(values)
+		slog.Info("Phase durations", "event", "durations", "phase", phase.name, "vms", len(values),
+			"min_seconds", round(lo), "max_seconds", round(hi), "avg_seconds", round(avg), "p95_seconds", round(p95))
+	}
+}
+
+// round rounds seconds to milliseconds for logging.
+func round(seconds float64) float64 {
+	return math.Round(seconds*1000) / 1000
+}
+
+// summaryRank orders statuses in the summary table: failures first, then
+// VMs the run did not finish, then skipped ones, then successes.
+func summaryRank(status string) int {
+	switch status {
+	case statusFailed:
+		return 0
+	case statusCancelled, statusPending:
+		return 1
+	case statusSkipped, statusMissing:
+		return 2
+	}
+	return 3
+}
+
+// printSummaryTable writes one aligned row per VM to w, ranked by
+// summaryRank and in file order within a rank. Errors are put on one line so
+// each VM keeps a single row.
+func printSummaryTable(w io.Writer, results []vmResult) error {
+	sorted := append([]vmResult(nil), results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return summaryRank(sorted[i].Status) < summaryRank(sorted[j].Status)
+	})
+	orDash := func(value string) string {
+		if value == "" {
+			return "-"
+		}
+		return value
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tLINE\tRESULT\tVM ID\tSECONDS\tERROR")
+	for _, result := range sorted {
+		line, seconds := "", ""
+		if result.Line > 0 {
+			line = strconv.Itoa(result.Line)
+		}
+		if result.Seconds > 0 {
+			seconds = strconv.FormatFloat(result.Seconds, 'f', 1, 64)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", result.Name, orDash(line), result.Status, orDash(result.ID),
+			orDash(seconds), strings.Join(strings.Fields(result.Error), " "))
+	}
+	return tw.Flush()
+}
+
+// writeReport writes the per-VM results to filename as a JSON array.
+func writeReport(filename string, results []vmResult) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write report file: %w", err)
+	}
+	return nil
+}
+
+// resultColumns are appended to csvColumns in the --output-csv file.
+var resultColumns = []string{"VM ID", "Status", "Error"}
+
+// writeResultsCSV writes one row per VM to filename: its input columns in
+// csvColumns order followed by resultColumns. The file has a header row, so it
+// can be read back with --header, which ignores the result columns.
+// vms and results must be in the same order. RootPassword is left empty so
+// the file holds no secrets and can't set a placeholder password if reused.
+func writeResultsCSV(filename string, vms []VMParams, results []vmResult) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create output CSV: %w", err)
+	}
+	defer f.Close()
+
+	password := positionalColumns()[normalizeColumn("RootPassword")]
+	w := csv.NewWriter(f)
+	w.Write(append(append([]string{}, csvColumns...), resultColumns...))
+	for i, vm := range vms {
+		row := append([]string{}, vm.record...)
+		row[password] = ""
+		row = append(row, results[i].ID, results[i].Status, results[i].Error)
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write output CSV: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,60 @@
+package ovirtvm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// httpStatusPattern extracts the HTTP status code the SDK embeds in its error messages.
+var httpStatusPattern = regexp.MustCompile(`HTTP response code is "(\d+)"`)
+
+// isTransient reports whether err looks like a temporary engine or network
+// failure worth retrying. Client errors such as a 409 conflict are never
+// retried, except 429, which a rate-limiting proxy in front of the engine sends.
+func isTransient(err error) bool {
+	if m := httpStatusPattern.FindStringSubmatch(err.Error()); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return code >= 500 || code == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// withRetry runs fn, retrying transient failures up to maxRetries times with
+// exponential backoff starting at one second.
+func withRetry(ctx context.Context, logger *slog.Logger, action string, maxRetries int, fn func() error) error {
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > maxRetries || !isTransient(err) {
+			return err
+		}
+		logger.Warn("Transient failure, retrying", "event", "retry", "action", action, "attempt", attempt, "attempts", maxRetries+1, "error", err, "backoff", backoff)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// waitRate blocks until limiter allows another engine call, or ctx is done.
+// A nil limiter never blocks.
+func waitRate(ctx context.Context, limiter *rate.Limiter) error {
+	if limiter == nil {
+		return nil
+	}
+	return limiter.Wait(ctx)
+}
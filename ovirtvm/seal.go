@@ -0,0 +1,79 @@
+package ovirtvm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// sealToTemplate shuts the VM down if it is running and creates a template
+// named name from it, waiting until the template's disks are copied. Linux
+// templates are sealed by the engine, which removes host keys, machine IDs
+// and the like; Windows guests are expected to have been generalized by
+// sysprep already. It returns the new template's ID.
+func sealToTemplate(ctx context.Context, conn *ovirtsdk4.Connection, vmService *ovirtsdk4.VmService, vmID, name string, windows bool, opts createOptions, logger *slog.Logger) (string, error) {
+	resp, err := vmService.Get().Send()
+	if err != nil {
+		return "", fmt.Errorf("failed to check VM status: %w", err)
+	}
+	var status ovirtsdk4.VmStatus
+	if vm, ok := resp.Vm(); ok {
+		status, _ = vm.Status()
+	}
+	if status != ovirtsdk4.VMSTATUS_DOWN {
+		// A clean shutdown, so the template doesn't capture a dirty filesystem
+		if _, err := vmService.Shutdown().Send(); err != nil {
+			return "", fmt.Errorf("failed to shut down VM: %w", err)
+		}
+		if _, err := waitForVMStatus(ctx, vmService, ovirtsdk4.VMSTATUS_DOWN, opts.StartTimeout); err != nil {
+			return "", fmt.Errorf("VM did not shut down: %w", err)
+		}
+		logger.Info("VM shut down for sealing", "event", "vm_shutdown")
+	}
+
+	template, err := ovirtsdk4.NewTemplateBuilder().Name(name).VmBuilder(ovirtsdk4.NewVmBuilder().Id(vmID)).Build()
+	if err != nil {
+		return "", fmt.Errorf("failed to build template %s: %w", name, err)
+	}
+	templatesService := conn.SystemService().TemplatesService()
+	addResp, err := templatesService.Add().Template(template).Seal(!windows).Send()
+	if err != nil {
+		return "", fmt.Errorf("failed to create template %s: %w", name, err)
+	}
+	created, ok := addResp.Template()
+	if !ok {
+		return "", fmt.Errorf("failed to create template %s: engine returned no template", name)
+	}
+	templateID, ok := created.Id()
+	if !ok {
+		return "", fmt.Errorf("failed to create template %s: engine returned no template ID", name)
+	}
+
+	templateService := templatesService.TemplateService(templateID)
+	deadline := time.Now().Add(opts.CreateTimeout)
+	for {
+		resp, err := templateService.Get().Send()
+		if err != nil {
+			return templateID, fmt.Errorf("failed to check template %s: %w", name, err)
+		}
+		var status ovirtsdk4.TemplateStatus
+		if template, ok := resp.Template(); ok {
+			status, _ = template.Status()
+		}
+		switch status {
+		case ovirtsdk4.TEMPLATESTATUS_OK:
+			return templateID, nil
+		case ovirtsdk4.TEMPLATESTATUS_ILLEGAL:
+			return templateID, fmt.Errorf("template %s is in an illegal state", name)
+		}
+		if time.Now().After(deadline) {
+			return templateID, fmt.Errorf("template %s still %s after %s", name, status, opts.CreateTimeout)
+		}
+		if err := sleepContext(ctx, vmStatusPollInterval); err != nil {
+			return templateID, err
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package ovirtvm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// createSnapshot takes a disk-only snapshot of the VM with the given
+// description and waits for the engine to finish it, returning its ID.
+func createSnapshot(ctx context.Context, vmService *ovirtsdk4.VmService, description string, timeout time.Duration) (string, error) {
+	snapshot, err := ovirtsdk4.NewSnapshotBuilder().Description(description).PersistMemorystate(false).Build()
+	if err != nil {
+		return "", fmt.Errorf("failed to build snapshot: %w", err)
+	}
+	resp, err := vmService.SnapshotsService().Add().Snapshot(snapshot).Send()
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	created, ok := resp.Snapshot()
+	if !ok {
+		return "", fmt.Errorf("failed to create snapshot: engine returned no snapshot")
+	}
+	id, ok := created.Id()
+	if !ok {
+		return "", fmt.Errorf("failed to create snapshot: engine returned no snapshot ID")
+	}
+
+	snapshotService := vmService.SnapshotsService().SnapshotService(id)
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := snapshotService.Get().Send()
+		if err != nil {
+			return id, fmt.Errorf("failed to check snapshot %s: %w", id, err)
+		}
+		var status ovirtsdk4.SnapshotStatus
+		if snapshot, ok := resp.Snapshot(); ok {
+			status, _ = snapshot.SnapshotStatus()
+		}
+		if status == ovirtsdk4.SNAPSHOTSTATUS_OK {
+			return id, nil
+		}
+		if time.Now().After(deadline) {
+			return id, fmt.Errorf("snapshot %s still %s after %s", id, status, timeout)
+		}
+		if err := sleepContext(ctx, vmStatusPollInterval); err != nil {
+			return id, err
+		}
+	}
+}
+
+// takeSnapshot takes the snapshot the row's Snapshot column or
+// --snapshot-after asks for and returns its ID. It returns "" and no error
+// when no snapshot is asked for, or when the run has been interrupted.
+func takeSnapshot(ctx context.Context, vmService *ovirtsdk4.VmService, vmParams VMParams, opts createOptions, logger *slog.Logger) (string, error) {
+	description := vmParams.Snapshot
+	if description == "" {
+		description = opts.Snapshot
+	}
+	if description == "" {
+		return "", nil
+	}
+	if ctx.Err() != nil {
+		logger.Warn("Run interrupted, snapshot not taken", "event", "snapshot_cancelled")
+		return "", nil
+	}
+	id, err := createSnapshot(ctx, vmService, description, opts.CreateTimeout)
+	if err != nil {
+		return "", err
+	}
+	logger.Info("Snapshot created", "event", "snapshot_created", "snapshot", id, "description", description)
+	return id, nil
+}
@@ -0,0 +1,52 @@
+package ovirtvm
+
+import (
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// isWindows reports whether an OsType column value names a Windows guest,
+// such as "windows_2019x64".
+func isWindows(osType string) bool {
+	return strings.HasPrefix(strings.ToLower(osType), "windows")
+}
+
+// windowsProblems lists the columns set on a Windows row that only take
+// effect through cloud-init.
+func windowsProblems(vm VMParams) []string {
+	var problems []string
+	if len(vm.SSHKeys) > 0 {
+		problems = append(problems, "SSHKey is not supported on Windows guests")
+	}
+	if vm.UserData != "" {
+		problems = append(problems, "CloudInitFile is not supported on Windows guests")
+	}
+	if len(vm.SearchDomains) > 0 {
+		problems = append(problems, "SearchDomains is not supported on Windows guests")
+	}
+	if vm.IP != "" || vm.IPv6 != "" {
+		problems = append(problems, "static addressing is applied through cloud-init and is not supported on Windows guests")
+	}
+	return problems
+}
+
+// newSysprepBuilder builds the initialization for a Windows guest; the engine
+// renders its sysprep answer file from these fields on first boot. The
+// RootPassword column becomes the Administrator password.
+func newSysprepBuilder(vm VMParams) *ovirtsdk4.InitializationBuilder {
+	builder := ovirtsdk4.NewInitializationBuilder().HostName(vm.Hostname)
+	if vm.RootPassword != "" {
+		builder.RootPassword(string(vm.RootPassword))
+	}
+	if vm.OrgName != "" {
+		builder.OrgName(vm.OrgName)
+	}
+	if vm.Domain != "" {
+		builder.Domain(vm.Domain)
+	}
+	if vm.DomainOU != "" {
+		builder.ActiveDirectoryOu(vm.DomainOU)
+	}
+	return builder
+}
@@ -0,0 +1,65 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"sync"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// tagMu serializes tag creation so concurrent VMs asking for the same new
+// tag don't race to create it twice.
+var tagMu sync.Mutex
+
+// ensureTag returns the ID of the named tag, creating the tag if needed.
+func ensureTag(conn *ovirtsdk4.Connection, name string) (string, error) {
+	tagMu.Lock()
+	defer tagMu.Unlock()
+
+	tagsService := conn.SystemService().TagsService()
+	resp, err := tagsService.List().Send()
+	if err != nil {
+		return "", fmt.Errorf("failed to list tags: %w", err)
+	}
+	if tags, ok := resp.Tags(); ok {
+		for _, tag := range tags.Slice() {
+			if tagName, _ := tag.Name(); tagName == name {
+				id, _ := tag.Id()
+				return id, nil
+			}
+		}
+	}
+
+	tag, err := ovirtsdk4.NewTagBuilder().Name(name).Build()
+	if err != nil {
+		return "", fmt.Errorf("failed to build tag %s: %w", name, err)
+	}
+	addResp, err := tagsService.Add().Tag(tag).Send()
+	if err != nil {
+		return "", fmt.Errorf("failed to create tag %s: %w", name, err)
+	}
+	created, ok := addResp.Tag()
+	if !ok {
+		return "", fmt.Errorf("failed to create tag %s: engine returned no tag", name)
+	}
+	id, _ := created.Id()
+	return id, nil
+}
+
+// tagVM assigns the named tags to the VM, creating missing tags first.
+func tagVM(conn *ovirtsdk4.Connection, vmService *ovirtsdk4.VmService, tags []string) error {
+	for _, name := range tags {
+		id, err := ensureTag(conn, name)
+		if err != nil {
+			return err
+		}
+		tag, err := ovirtsdk4.NewTagBuilder().Id(id).Build()
+		if err != nil {
+			return fmt.Errorf("failed to build tag %s: %w", name, err)
+		}
+		if _, err := vmService.TagsService().Add().Tag(tag).Send(); err != nil {
+			return fmt.Errorf("failed to assign tag %s: %w", name, err)
+		}
+	}
+	return nil
+}
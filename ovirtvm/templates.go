@@ -0,0 +1,178 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// blankTemplateName is the engine's built-in empty template.
+const blankTemplateName = "Blank"
+
+// templateDisk is one of a template's disks, described the way the clone
+// should get it.
+type templateDisk struct {
+	ID             string
+	Spec           diskSpec // The template disk's own size, interface, format and sparseness
+	StorageDomains []string // IDs of the storage domains holding a copy of the disk
+}
+
+// templateDevices returns the template's disks, boot disk first, and the name
+// of its first NIC, which the clone reuses.
+func templateDevices(template *ovirtsdk4.Template) ([]templateDisk, string, error) {
+	templateName, _ := template.Name()
+
+	var attachments []*ovirtsdk4.DiskAttachment
+	if attachmentSlice, ok := template.DiskAttachments(); ok {
+		attachments = attachmentSlice.Slice()
+	}
+	if len(attachments) == 0 {
+		return nil, "", fmt.Errorf("template %s has no disk attachments", templateName)
+	}
+	var disks []templateDisk
+	for _, attachment := range attachments {
+		disk, ok := attachment.Disk()
+		if !ok {
+			return nil, "", fmt.Errorf("template %s disk attachment has no disk", templateName)
+		}
+		id, ok := disk.Id()
+		if !ok {
+			return nil, "", fmt.Errorf("template %s disk has no ID", templateName)
+		}
+		td := templateDisk{ID: id}
+		td.Spec.Size, _ = disk.ProvisionedSize()
+		td.Spec.Interface, _ = attachment.Interface()
+		td.Spec.Format, _ = disk.Format()
+		td.Spec.Sparse, _ = disk.Sparse()
+		if domains, ok := disk.StorageDomains(); ok {
+			for _, domain := range domains.Slice() {
+				if domainID, ok := domain.Id(); ok {
+					td.StorageDomains = append(td.StorageDomains, domainID)
+				}
+			}
+		}
+		if bootable, _ := attachment.Bootable(); bootable {
+			disks = append([]templateDisk{td}, disks...)
+		} else {
+			disks = append(disks, td)
+		}
+	}
+
+	var templateNics []*ovirtsdk4.Nic
+	if nics, ok := template.Nics(); ok {
+		templateNics = nics.Slice()
+	}
+	if len(templateNics) == 0 {
+		return nil, "", fmt.Errorf("template %s has no nics", templateName)
+	}
+	vnicName, ok := templateNics[0].Name()
+	if !ok {
+		return nil, "", fmt.Errorf("template %s nic has no name", templateName)
+	}
+	return disks, vnicName, nil
+}
+
+// uuidPattern matches engine object IDs, which Template and Cluster columns
+// may hold instead of a name.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// isID reports whether value is an engine object ID rather than a name.
+func isID(value string) bool {
+	return uuidPattern.MatchString(value)
+}
+
+// templateFollow lists the template links createVM needs resolved.
+const templateFollow = "disk_attachments.disk,nics"
+
+// findTemplate looks up a template by ID, or by name along with its disks and
+// nics. Versions of one template share its name and count as one match; the
+// first is used as before. Names shared by unrelated templates are rejected
+// so the row can be given an ID instead.
+func findTemplate(conn *ovirtsdk4.Connection, name string) (*ovirtsdk4.Template, error) {
+	templatesService := conn.SystemService().TemplatesService()
+	if isID(name) {
+		resp, err := templatesService.TemplateService(name).Get().Follow(templateFollow).Send()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve template %s: %w", name, err)
+		}
+		template, ok := resp.Template()
+		if !ok {
+			return nil, fmt.Errorf("template %s not found", name)
+		}
+		return template, nil
+	}
+
+	resp, err := templatesService.List().Search("name=" + name).Follow(templateFollow).Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve template %s: %w", name, err)
+	}
+	templates, ok := resp.Templates()
+	if !ok || len(templates.Slice()) == 0 {
+		return nil, fmt.Errorf("template %s not found", name)
+	}
+	bases := make(map[string]bool)
+	var ids []string
+	for _, template := range templates.Slice() {
+		id, _ := template.Id()
+		base := id
+		if version, ok := template.Version(); ok {
+			if baseTemplate, ok := version.BaseTemplate(); ok {
+				base, _ = baseTemplate.Id()
+			}
+		}
+		if !bases[base] {
+			bases[base] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > 1 {
+		return nil, fmt.Errorf("template name %s matches %d templates (IDs: %s); use the template ID instead", name, len(ids), strings.Join(ids, ", "))
+	}
+	return templates.Slice()[0], nil
+}
+
+// searchTemplate looks up the templates matching an engine search expression,
+// such as "tag=stable" or "name=rhel9* and status=ok", and returns the most
+// recently created one along with its disks and nics.
+func searchTemplate(conn *ovirtsdk4.Connection, search string) (*ovirtsdk4.Template, error) {
+	resp, err := conn.SystemService().TemplatesService().List().Search(search).Follow(templateFollow).Send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to search templates for %q: %w", search, err)
+	}
+	templates, ok := resp.Templates()
+	if !ok || len(templates.Slice()) == 0 {
+		return nil, fmt.Errorf("no template matches search %q", search)
+	}
+	var newest *ovirtsdk4.Template
+	var newestTime time.Time
+	for _, template := range templates.Slice() {
+		created, _ := template.CreationTime()
+		if newest == nil || created.After(newestTime) {
+			newest, newestTime = template, created
+		}
+	}
+	return newest, nil
+}
+
+// checkTemplateDisks checks the template's disks against the row: a thin
+// clone needs the template's boot disk on the boot disk's storage domain,
+// and incremental backup needs every disk to be cow. The boot disk's format
+// is set by the row; the template's other disks keep theirs.
+func checkTemplateDisks(vmParams VMParams, refs *vmReferences) error {
+	if vmParams.Provisioning == provisioningThin {
+		if err := checkThinStorage(refs.templateName, refs.templateDisks[0], refs.storageDomains[refs.disks[0].StorageDomain]); err != nil {
+			return err
+		}
+	}
+	if vmParams.Backup != nil && *vmParams.Backup {
+		for i, td := range refs.templateDisks[1:] {
+			if td.Spec.Format == ovirtsdk4.DISKFORMAT_RAW {
+				return fmt.Errorf("Backup requires cow disks, but disk %s from template %s is raw", vmParams.diskName(i+1), refs.templateName)
+			}
+		}
+	}
+	return nil
+}
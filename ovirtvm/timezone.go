@@ -0,0 +1,164 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// windowsTimeZones lists the Windows time zone names the engine accepts for
+// Windows guests, which render them into the sysprep answer file.
+var windowsTimeZones = []string{
+	"Dateline Standard Time",
+	"UTC-11",
+	"Hawaiian Standard Time",
+	"Alaskan Standard Time",
+	"Pacific Standard Time (Mexico)",
+	"Pacific Standard Time",
+	"US Mountain Standard Time",
+	"Mountain Standard Time (Mexico)",
+	"Mountain Standard Time",
+	"Central America Standard Time",
+	"Central Standard Time",
+	"Central Standard Time (Mexico)",
+	"Canada Central Standard Time",
+	"SA Pacific Standard Time",
+	"Eastern Standard Time",
+	"US Eastern Standard Time",
+	"Venezuela Standard Time",
+	"Paraguay Standard Time",
+	"Atlantic Standard Time",
+	"Central Brazilian Standard Time",
+	"SA Western Standard Time",
+	"Pacific SA Standard Time",
+	"Newfoundland Standard Time",
+	"E. South America Standard Time",
+	"Argentina Standard Time",
+	"SA Eastern Standard Time",
+	"Greenland Standard Time",
+	"Montevideo Standard Time",
+	"UTC-02",
+	"Mid-Atlantic Standard Time",
+	"Azores Standard Time",
+	"Cape Verde Standard Time",
+	"Morocco Standard Time",
+	"UTC",
+	"GMT Standard Time",
+	"Greenwich Standard Time",
+	"W. Europe Standard Time",
+	"Central Europe Standard Time",
+	"Romance Standard Time",
+	"Central European Standard Time",
+	"W. Central Africa Standard Time",
+	"Namibia Standard Time",
+	"Jordan Standard Time",
+	"GTB Standard Time",
+	"Middle East Standard Time",
+	"Egypt Standard Time",
+	"Syria Standard Time",
+	"South Africa Standard Time",
+	"FLE Standard Time",
+	"Turkey Standard Time",
+	"Israel Standard Time",
+	"E. Europe Standard Time",
+	"Arabic Standard Time",
+	"Arab Standard Time",
+	"Russian Standard Time",
+	"E. Africa Standard Time",
+	"Iran Standard Time",
+	"Arabian Standard Time",
+	"Azerbaijan Standard Time",
+	"Mauritius Standard Time",
+	"Georgian Standard Time",
+	"Caucasus Standard Time",
+	"Afghanistan Standard Time",
+	"Pakistan Standard Time",
+	"West Asia Standard Time",
+	"India Standard Time",
+	"Sri Lanka Standard Time",
+	"Nepal Standard Time",
+	"Central Asia Standard Time",
+	"Bangladesh Standard Time",
+	"Ekaterinburg Standard Time",
+	"Myanmar Standard Time",
+	"SE Asia Standard Time",
+	"N. Central Asia Standard Time",
+	"China Standard Time",
+	"North Asia Standard Time",
+	"Singapore Standard Time",
+	"W. Australia Standard Time",
+	"Taipei Standard Time",
+	"Ulaanbaatar Standard Time",
+	"North Asia East Standard Time",
+	"Tokyo Standard Time",
+	"Korea Standard Time",
+	"Cen. Australia Standard Time",
+	"AUS Central Standard Time",
+	"E. Australia Standard Time",
+	"AUS Eastern Standard Time",
+	"West Pacific Standard Time",
+	"Tasmania Standard Time",
+	"Yakutsk Standard Time",
+	"Central Pacific Standard Time",
+	"Vladivostok Standard Time",
+	"New Zealand Standard Time",
+	"UTC+12",
+	"Fiji Standard Time",
+	"Magadan Standard Time",
+	"Kamchatka Standard Time",
+	"Tonga Standard Time",
+	"Samoa Standard Time",
+}
+
+// timeZoneProblem checks a TimeZone column value: a Windows time zone name
+// such as "GMT Standard Time" on Windows guests, an IANA name such as
+// "Europe/London" on all others. An empty value keeps the template's.
+func timeZoneProblem(name string, windows bool) string {
+	if name == "" {
+		return ""
+	}
+	if windows {
+		for _, zone := range windowsTimeZones {
+			if zone == name {
+				return ""
+			}
+		}
+		return fmt.Sprintf("unknown Windows time zone %q, e.g. \"GMT Standard Time\"", name)
+	}
+	if name == "Local" {
+		return "time zone Local is not allowed, name the zone"
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return fmt.Sprintf("unknown time zone %q, e.g. \"Europe/London\"", name)
+	}
+	return ""
+}
+
+// parseSerialNumber splits a SerialNumber column value into the policy the
+// engine uses to pick the VM's SMBIOS serial number and, for the custom
+// policy, the number itself. "host" and "vm" name the engine's policies;
+// any other value is used as the serial number. An empty value keeps the
+// template's policy.
+func parseSerialNumber(value string) (ovirtsdk4.SerialNumberPolicy, string) {
+	switch {
+	case value == "":
+		return "", ""
+	case strings.EqualFold(value, string(ovirtsdk4.SERIALNUMBERPOLICY_HOST)):
+		return ovirtsdk4.SERIALNUMBERPOLICY_HOST, ""
+	case strings.EqualFold(value, string(ovirtsdk4.SERIALNUMBERPOLICY_VM)):
+		return ovirtsdk4.SERIALNUMBERPOLICY_VM, ""
+	}
+	return ovirtsdk4.SERIALNUMBERPOLICY_CUSTOM, value
+}
+
+// newSerialNumberBuilder builds the serial number setting for a policy
+// returned by parseSerialNumber.
+func newSerialNumberBuilder(policy ovirtsdk4.SerialNumberPolicy, number string) *ovirtsdk4.SerialNumberBuilder {
+	serialBuilder := ovirtsdk4.NewSerialNumberBuilder().Policy(policy)
+	if policy == ovirtsdk4.SERIALNUMBERPOLICY_CUSTOM {
+		serialBuilder.Value(number)
+	}
+	return serialBuilder
+}
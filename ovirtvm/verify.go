@@ -0,0 +1,54 @@
+package ovirtvm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// engineInfo is what --verify reports about the engine and the login.
+type engineInfo struct {
+	Product string `json:"product"`
+	Version string `json:"version"`
+	User    string `json:"user"`
+}
+
+// verifyConnection fetches the engine's API root, which only succeeds with a
+// working URL and valid credentials, and prints the engine version and the
+// authenticated user in the given output format.
+func verifyConnection(conn *ovirtsdk4.Connection, format string, w io.Writer) error {
+	if format != "plain" && format != "json" {
+		return fmt.Errorf("invalid output format %q: must be plain or json", format)
+	}
+	resp, err := conn.SystemService().Get().Follow("authenticated_user").Send()
+	if err != nil {
+		return fmt.Errorf("failed to query the engine: %w", err)
+	}
+	api, ok := resp.Api()
+	if !ok {
+		return fmt.Errorf("engine returned no API information")
+	}
+
+	var info engineInfo
+	if product, ok := api.ProductInfo(); ok {
+		info.Product, _ = product.Name()
+		if version, ok := product.Version(); ok {
+			info.Version, _ = version.FullVersion()
+		}
+	}
+	if user, ok := api.AuthenticatedUser(); ok {
+		if info.User, ok = user.Principal(); !ok {
+			info.User, _ = user.UserName()
+		}
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	_, err = fmt.Fprintf(w, "product\t%s\nversion\t%s\nuser\t%s\n", info.Product, info.Version, info.User)
+	return err
+}
@@ -0,0 +1,31 @@
+package ovirtvm
+
+import (
+	"fmt"
+	"strings"
+
+	ovirtsdk4 "github.com/ovirt/go-ovirt"
+)
+
+// vmTypes lists the VM optimization profiles accepted in the CSV.
+var vmTypes = []ovirtsdk4.VmType{
+	ovirtsdk4.VMTYPE_DESKTOP,
+	ovirtsdk4.VMTYPE_HIGH_PERFORMANCE,
+	ovirtsdk4.VMTYPE_SERVER,
+}
+
+// parseVMType maps a CSV value to an SDK VM type, defaulting to server when
+// the value is empty.
+func parseVMType(value string) (ovirtsdk4.VmType, error) {
+	if value == "" {
+		return ovirtsdk4.VMTYPE_SERVER, nil
+	}
+	valid := make([]string, 0, len(vmTypes))
+	for _, vmType := range vmTypes {
+		if strings.EqualFold(value, string(vmType)) {
+			return vmType, nil
+		}
+		valid = append(valid, string(vmType))
+	}
+	return "", fmt.Errorf("unknown VM type %q (valid: %s)", value, strings.Join(valid, ", "))
+}
@@ -0,0 +1,72 @@
+package ovirtvm
+
+import (
+	"context"
+	"sync"
+)
+
+// startWorkers processes vms on a fixed number of workers that read row
+// indices off a jobs channel, recording each result in progress. With a
+// non-nil limit, workers also wait for it before each row, so fewer than
+// concurrency rows may be in flight. Rows not yet handed out when ctx is
+// cancelled are recorded as cancelled. The returned channel is closed once
+// every worker has finished.
+func startWorkers(ctx context.Context, vms []VMParams, concurrency int, limit *adaptiveLimit, progress *progress, process func(context.Context, VMParams) vmResult) <-chan struct{} {
+	done := make(chan struct{})
+	if concurrency == 1 {
+		// A single worker walks the rows strictly in CSV order, so logs read top to bottom
+		go func() {
+			defer close(done)
+			for i, vm := range vms {
+				if ctx.Err() != nil {
+					progress.record(i, cancelledResult(vm))
+					continue
+				}
+				progress.record(i, process(ctx, vm))
+			}
+		}()
+		return done
+	}
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range vms {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				for ; i < len(vms); i++ {
+					progress.record(i, cancelledResult(vms[i]))
+				}
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if limit == nil {
+					progress.record(i, process(ctx, vms[i]))
+					continue
+				}
+				if !limit.acquire(ctx) {
+					progress.record(i, cancelledResult(vms[i]))
+					continue
+				}
+				result := process(ctx, vms[i])
+				limit.release(result)
+				progress.record(i, result)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
@@ -0,0 +1,142 @@
+package ovirtvm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// testRows returns n rows named vm0, vm1, ... on lines 1, 2, ...
+func testRows(n int) []VMParams {
+	vms := make([]VMParams, n)
+	for i := range vms {
+		vms[i] = VMParams{Name: fmt.Sprintf("vm%d", i), line: i + 1}
+	}
+	return vms
+}
+
+// callLog records which rows a fake process func was called for, in order.
+type callLog struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (c *callLog) process(ctx context.Context, vm VMParams) vmResult {
+	c.mu.Lock()
+	c.names = append(c.names, vm.Name)
+	c.mu.Unlock()
+	return vmResult{Name: vm.Name, Line: vm.line, Status: statusCreated}
+}
+
+func (c *callLog) counts() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]int)
+	for _, name := range c.names {
+		counts[name]++
+	}
+	return counts
+}
+
+// TestStartWorkersProcessesEveryRowOnce checks that each row is handed to
+// exactly one worker and its result recorded at the row's index.
+func TestStartWorkersProcessesEveryRowOnce(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		limit       *adaptiveLimit
+	}{
+		{"serial", 1, nil},
+		{"pool", 8, nil},
+		{"adaptive", 8, newAdaptiveLimit(1, 8)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vms := testRows(100)
+			progress := newProgress(vms)
+			var calls callLog
+			<-startWorkers(context.Background(), vms, tt.concurrency, tt.limit, progress, calls.process)
+
+			counts := calls.counts()
+			for i, result := range progress.results() {
+				name := vms[i].Name
+				if counts[name] != 1 {
+					t.Errorf("%s processed %d times, want 1", name, counts[name])
+				}
+				if result.Name != name || result.Status != statusCreated {
+					t.Errorf("result %d = %+v, want %s created", i, result, name)
+				}
+			}
+		})
+	}
+}
+
+// TestStartWorkersCancelsUnstartedRows cancels the run part way through and
+// checks that rows never handed out are recorded as cancelled, not processed.
+func TestStartWorkersCancelsUnstartedRows(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			vms := testRows(50)
+			progress := newProgress(vms)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var calls callLog
+			var mu sync.Mutex
+			started := 0
+			process := func(ctx context.Context, vm VMParams) vmResult {
+				mu.Lock()
+				started++
+				if started == 5 {
+					cancel()
+				}
+				mu.Unlock()
+				return calls.process(ctx, vm)
+			}
+			<-startWorkers(ctx, vms, concurrency, nil, progress, process)
+
+			counts := calls.counts()
+			cancelled := 0
+			for i, result := range progress.results() {
+				name := vms[i].Name
+				switch result.Status {
+				case statusCancelled:
+					cancelled++
+					if counts[name] != 0 {
+						t.Errorf("%s was processed but recorded as cancelled", name)
+					}
+				case statusCreated:
+					if counts[name] != 1 {
+						t.Errorf("%s processed %d times, want 1", name, counts[name])
+					}
+				default:
+					t.Errorf("%s has status %q, want created or cancelled", name, result.Status)
+				}
+			}
+			if cancelled == 0 {
+				t.Errorf("no rows were cancelled")
+			}
+			if concurrency == 1 && cancelled != len(vms)-5 {
+				t.Errorf("%d rows cancelled, want %d", cancelled, len(vms)-5)
+			}
+		})
+	}
+}
+
+// TestStartWorkersSerialKeepsRowOrder checks that a concurrency of 1
+// processes rows strictly in input order.
+func TestStartWorkersSerialKeepsRowOrder(t *testing.T) {
+	vms := testRows(30)
+	var calls callLog
+	<-startWorkers(context.Background(), vms, 1, nil, newProgress(vms), calls.process)
+
+	if len(calls.names) != len(vms) {
+		t.Fatalf("processed %d rows, want %d", len(calls.names), len(vms))
+	}
+	for i, name := range calls.names {
+		if name != vms[i].Name {
+			t.Fatalf("row %d processed as %s, want %s (order %v)", i, name, vms[i].Name, calls.names)
+		}
+	}
+}